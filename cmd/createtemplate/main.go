@@ -11,23 +11,44 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/gocsaf/fakedoc/pkg/fakedoc"
 )
 
+const listTypesDocumentation = `
+Print the names and kinds of the types of the template instead of the
+template itself.
+`
+
 func main() {
-	err := createTemplate()
+	var listTypes bool
+	flag.BoolVar(&listTypes, "list-types", false, listTypesDocumentation)
+	flag.Parse()
+
+	err := createTemplate(listTypes)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func createTemplate() error {
+func createTemplate(listTypes bool) error {
 	template, err := fakedoc.FromCSAFSchema()
 	if err != nil {
 		return err
 	}
+	if err := errors.Join(template.Validate()...); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	if listTypes {
+		for _, info := range template.ListTypes() {
+			fmt.Printf("%s\t%s\n", info.Name, info.Kind)
+		}
+		return nil
+	}
 	return template.Write(os.Stdout)
 }
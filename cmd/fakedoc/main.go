@@ -10,32 +10,45 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/gocsaf/fakedoc/pkg/fakedoc"
 )
 
 const (
+	templateDocumentation = `
+Template file with changes to the built-in template. May be given
+multiple times. The files are applied in order, so later files take
+precedence.
+`
+
 	seedDocumentation = `
 random number seed, format 'pcg:<1-8 hex digits>:<1-8 hex digits>'.
 If omitted, the generator uses a random seed.
 `
 
 	outputDocumentation = `
-output filename. Setting this will also set the tracking ID in the
-generated file so that it matches the filename. The filename must end
-with '.json'
+output filename. For CSAF documents, setting this will also set the
+tracking ID in the generated file so that it matches the filename. The
+filename must end with '.json' in that case.
 `
 
 	numOutputDocumentation = `
@@ -45,11 +58,128 @@ will be replaced with the number of the file, starting with 0.
 `
 
 	formattedDocumentation = `
-Output JSON should be formatted.
+Output JSON should be formatted. Deprecated, use --format=pretty.
+`
+
+	formatDocumentation = `
+Output format: 'json' for compact JSON, 'pretty' for indented JSON or
+'jsonl' for JSON Lines. With 'jsonl' all documents are written to the
+same output, stdout or the file given with -o, one document per line.
+The tracking IDs are not set from the filename in that case.
 `
 
 	limitsDocumentation = `
 Guidance on the Size of CSAF Documents.
+`
+
+	allOfRootOneOfDocumentation = `
+If the root type is a oneof, generate one document for each of the
+alternatives using the same seed. The output filename must be given and
+the documents are named like the output file with the number of the
+alternative appended, e.g. output-0.json, output-1.json.
+`
+
+	excludePropertiesDocumentation = `
+Comma separated list of properties of the root object that are not
+generated.
+`
+
+	noCSAFSpecialsDocumentation = `
+Do not apply the CSAF specific adjustments to the built-in template,
+such as generating product IDs that are referenced elsewhere in the
+document.
+`
+
+	limitStringsDocumentation = `
+Maximum length of all strings. Applied in addition to the limits file.
+`
+
+	limitURIsDocumentation = `
+Maximum length of all URIs. Applied in addition to the limits file.
+`
+
+	profileGenDocumentation = `
+Measure the time spent generating each type and print a report sorted
+by total time to stderr after the generation.
+`
+
+	setVarDocumentation = `
+Set a template variable used by varref types, format 'name=value'.
+May be given multiple times.
+`
+
+	sizeFactorDocumentation = `
+Scale the size of the generated documents. Values below 1 lead to
+smaller documents. Objects without a maximum number of properties then
+get at most that fraction of their properties, plus one. The limits
+of the limits file are scaled by the same factor.
+`
+
+	noSizeFactorObjectsDocumentation = `
+Do not apply the size factor to objects without a maximum number of
+properties, so that they may have all of their properties.
+`
+
+	schemaDocumentation = `
+JSON schema file to generate documents for instead of the built-in CSAF
+schema. Relative references to other JSON files in the same directory
+are resolved locally.
+`
+
+	watchDocumentation = `
+Watch the template and limits files and generate the output again
+whenever one of them changes. Errors are reported without exiting.
+Requires an output file. Meant for developing templates.
+`
+
+	listNamespacesDocumentation = `
+Print the namespaces of each generated document to stderr, with the
+number of IDs and the number of references to them.
+`
+
+	compressDocumentation = `
+Compress the output with gzip. '.gz' is appended to output filenames
+that don't end with it already.
+`
+
+	zipDocumentation = `
+Write the documents into this zip archive instead of separate files.
+The output filename given with -o is used as the name of the documents
+in the archive and must be given. Can't be combined with --compress,
+--output-dir or --format=jsonl.
+`
+
+	outputDirDocumentation = `
+Directory for the output files. It's created if it doesn't exist. The
+output filename given with -o must not contain a directory then.
+`
+
+	parallelDocumentation = `
+Number of documents generated concurrently when generating multiple
+documents with -n. Can't be combined with --seed, --format=jsonl, --zip,
+--profile-gen or --all-of-root-oneof.
+`
+
+	maxDepthDocumentation = `
+Maximum nesting depth of the generated documents. Deeply nested
+structures like product_tree/branches may need a larger depth, smaller
+values generate smaller documents faster. 0 means the default of 25.
+`
+
+	timeoutDocumentation = `
+Maximum time spent generating a single document, e.g. '30s'. If it is
+exceeded, fakedoc stops with an error. 0 means no limit.
+`
+
+	listTypesDocumentation = `
+Print the names and kinds of the types of the template, after applying
+the template files, and exit without generating documents.
+`
+
+	verboseDocumentation = `
+Print information about each generated document to stderr, such as
+the number of IDs and references in each namespace. Also reports the
+progress while generating large documents.
 `
 )
 
@@ -59,92 +189,605 @@ func check(err error) {
 	}
 }
 
+// options holds the settings given on the command line
+type options struct {
+	templatefiles  templateFiles
+	listTypes      bool
+	limitsfile     string
+	seed           string
+	outputfile     string
+	numOutputs     int
+	formatted      bool
+	format         string
+	allOfRootOneOf bool
+	excludeProps   string
+	noCSAFSpecials bool
+	verbose        bool
+	limitStrings   int
+	limitURIs      int
+	profileGen     bool
+	vars           templateVars
+
+	sizeFactor          float64
+	noSizeFactorObjects bool
+	watch               bool
+	schemafile          string
+	listNamespaces      bool
+	timeout             time.Duration
+	outputDir           string
+	compress            bool
+	zipfile             string
+	maxDepth            int
+	parallel            int
+}
+
+// progressInterval is the number of generated values between two
+// progress reports in verbose mode
+const progressInterval = 10000
+
+// reportMutex serializes the reports about generated documents
+var reportMutex sync.Mutex
+
+// watchInterval is the interval in which watch mode checks for changed
+// files
+const watchInterval = 500 * time.Millisecond
+
+// templateFiles implements flag.Value for repeated template files
+type templateFiles []string
+
+func (tf *templateFiles) String() string {
+	return strings.Join(*tf, ",")
+}
+
+func (tf *templateFiles) Set(s string) error {
+	*tf = append(*tf, s)
+	return nil
+}
+
+// templateVars implements flag.Value for repeated name=value settings
+type templateVars map[string]string
+
+func (tv *templateVars) String() string {
+	return fmt.Sprint(map[string]string(*tv))
+}
+
+func (tv *templateVars) Set(s string) error {
+	name, value, found := strings.Cut(s, "=")
+	if !found || name == "" {
+		return fmt.Errorf("%q doesn't have the format name=value", s)
+	}
+	if *tv == nil {
+		*tv = make(templateVars)
+	}
+	(*tv)[name] = value
+	return nil
+}
+
 func main() {
-	var (
-		templatefile string
-		limitsfile   string
-		seed         string
-		outputfile   string
-		numOutputs   int
-		formatted    bool
-	)
-
-	flag.StringVar(&templatefile, "template", "", "template file")
-	flag.StringVar(&limitsfile, "l", "", limitsDocumentation)
-	flag.StringVar(&seed, "seed", "", seedDocumentation)
-	flag.StringVar(&outputfile, "o", "", outputDocumentation)
-	flag.IntVar(&numOutputs, "n", 1, numOutputDocumentation)
-	flag.BoolVar(&formatted, "f", false, formattedDocumentation)
+	var opts options
+
+	flag.Var(&opts.templatefiles, "template", templateDocumentation)
+	flag.StringVar(&opts.limitsfile, "l", "", limitsDocumentation)
+	flag.StringVar(&opts.seed, "seed", "", seedDocumentation)
+	flag.StringVar(&opts.outputfile, "o", "", outputDocumentation)
+	flag.IntVar(&opts.numOutputs, "n", 1, numOutputDocumentation)
+	flag.BoolVar(&opts.formatted, "f", false, formattedDocumentation)
+	flag.StringVar(&opts.format, "format", "json", formatDocumentation)
+	flag.BoolVar(&opts.allOfRootOneOf, "all-of-root-oneof", false, allOfRootOneOfDocumentation)
+	flag.StringVar(&opts.excludeProps, "exclude-properties", "", excludePropertiesDocumentation)
+	flag.BoolVar(&opts.noCSAFSpecials, "no-csaf-specials", false, noCSAFSpecialsDocumentation)
+	flag.BoolVar(&opts.verbose, "verbose", false, verboseDocumentation)
+	flag.IntVar(&opts.limitStrings, "limit-strings", 0, limitStringsDocumentation)
+	flag.IntVar(&opts.limitURIs, "limit-uris", 0, limitURIsDocumentation)
+	flag.BoolVar(&opts.profileGen, "profile-gen", false, profileGenDocumentation)
+	flag.Var(&opts.vars, "set-var", setVarDocumentation)
+	flag.Float64Var(&opts.sizeFactor, "size-factor", 1.0, sizeFactorDocumentation)
+	flag.BoolVar(&opts.noSizeFactorObjects, "no-size-factor-objects", false, noSizeFactorObjectsDocumentation)
+	flag.BoolVar(&opts.watch, "watch", false, watchDocumentation)
+	flag.StringVar(&opts.schemafile, "schema", "", schemaDocumentation)
+	flag.BoolVar(&opts.listNamespaces, "list-namespaces", false, listNamespacesDocumentation)
+	flag.BoolVar(&opts.listTypes, "list-types", false, listTypesDocumentation)
+	flag.DurationVar(&opts.timeout, "timeout", 0, timeoutDocumentation)
+	flag.IntVar(&opts.maxDepth, "max-depth", 0, maxDepthDocumentation)
+	flag.IntVar(&opts.parallel, "parallel", 1, parallelDocumentation)
+	flag.StringVar(&opts.outputDir, "output-dir", "", outputDirDocumentation)
+	flag.BoolVar(&opts.compress, "compress", false, compressDocumentation)
+	flag.StringVar(&opts.zipfile, "zip", "", zipDocumentation)
 	flag.Parse()
 
-	if numOutputs > 1 && outputfile == "" {
+	if opts.formatted {
+		log.Print("warning: -f is deprecated, use --format=pretty")
+		opts.format = "pretty"
+	}
+	check(opts.checkFormat())
+	check(opts.checkZip())
+	check(opts.checkParallel())
+	if opts.numOutputs > 1 && opts.outputfile == "" && opts.format != "jsonl" {
 		log.Fatal("Multiple outputs require an explicit output file template")
 	}
+	check(opts.applyOutputDir())
 
-	var (
-		rng *rand.Rand
-		err error
-	)
-	if seed != "" {
-		rng, err = fakedoc.ParseSeed(seed)
-		check(err)
+	if opts.watch {
+		check(watch(&opts))
+		return
+	}
+	check(generate(&opts))
+}
+
+// watch generates the output whenever the template file or the limits
+// file changes. It only returns if watch mode cannot be used with the
+// options.
+func watch(opts *options) error {
+	if opts.outputfile == "" {
+		return errors.New("watch mode requires an output file")
+	}
+	files := slices.Clone(opts.templatefiles)
+	if opts.limitsfile != "" {
+		files = append(files, opts.limitsfile)
+	}
+	if len(files) == 0 {
+		return errors.New("watch mode requires a template or limits file")
 	}
 
-	check(generate(
-		templatefile, rng,
-		outputfile, limitsfile,
-		numOutputs, formatted))
+	// Files that cannot be accessed, e.g. while an editor replaces
+	// them, have the zero time.
+	modTimes := func() []time.Time {
+		times := make([]time.Time, len(files))
+		for i, file := range files {
+			if info, err := os.Stat(file); err == nil {
+				times[i] = info.ModTime()
+			}
+		}
+		return times
+	}
+	run := func() {
+		start := time.Now()
+		if err := generate(opts); err != nil {
+			log.Printf("generation failed: %v", err)
+			return
+		}
+		log.Printf("generated %s in %v", opts.outputfile,
+			time.Since(start).Round(time.Millisecond))
+	}
+
+	last := modTimes()
+	run()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if current := modTimes(); !slices.EqualFunc(current, last, time.Time.Equal) {
+			last = current
+			run()
+		}
+	}
+	return nil
 }
 
-func generate(
-	templatefile string,
-	rng *rand.Rand,
-	outputfile, limitsfile string,
-	numOutputs int,
-	formatted bool,
-) error {
-	templ, err := fakedoc.FromCSAFSchema()
+// checkFormat checks the output format.
+func (opts *options) checkFormat() error {
+	switch opts.format {
+	case "json", "pretty":
+		return nil
+	case "jsonl":
+		if strings.Contains(opts.outputfile, "{{") {
+			return errors.New("format jsonl writes all documents to a single output file")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q", opts.format)
+	}
+}
+
+// checkZip checks that the options can be used with a zip archive.
+func (opts *options) checkZip() error {
+	switch {
+	case opts.zipfile == "":
+		return nil
+	case opts.outputfile == "":
+		return errors.New("a zip archive requires an output file")
+	case opts.compress:
+		return errors.New("--zip and --compress are mutually exclusive")
+	case opts.outputDir != "":
+		return errors.New("--zip and --output-dir are mutually exclusive")
+	case opts.format == "jsonl":
+		return errors.New("format jsonl is not supported with a zip archive")
+	}
+	return nil
+}
+
+// checkParallel checks that the options can be used when generating
+// documents in parallel. The documents are generated in no particular
+// order, so a seed would not make them reproducible.
+func (opts *options) checkParallel() error {
+	switch {
+	case opts.parallel < 1:
+		return fmt.Errorf("number of parallel generators %d is not positive", opts.parallel)
+	case opts.parallel == 1:
+		return nil
+	case opts.seed != "":
+		return errors.New("--parallel and --seed are mutually exclusive")
+	case opts.format == "jsonl":
+		return errors.New("format jsonl is not supported with --parallel")
+	case opts.zipfile != "":
+		return errors.New("--parallel and --zip are mutually exclusive")
+	case opts.profileGen:
+		return errors.New("--parallel and --profile-gen are mutually exclusive")
+	case opts.allOfRootOneOf:
+		return errors.New("--parallel and --all-of-root-oneof are mutually exclusive")
+	}
+	return nil
+}
+
+// openZip creates the zip archive if one is given in the options. The
+// returned function closes the archive. If no archive is given, the
+// zip writer is nil.
+func (opts *options) openZip() (*zip.Writer, func() error, error) {
+	if opts.zipfile == "" {
+		return nil, func() error { return nil }, nil
+	}
+	file, err := os.Create(opts.zipfile)
 	if err != nil {
+		return nil, nil, err
+	}
+	zw := zip.NewWriter(file)
+	return zw, func() error { return errors.Join(zw.Close(), file.Close()) }, nil
+}
+
+// applyOutputDir creates the output directory, if given, and makes the
+// output filename refer to it.
+func (opts *options) applyOutputDir() error {
+	if opts.outputDir == "" {
+		return nil
+	}
+	if opts.outputfile == "" {
+		return errors.New("an output directory requires an output file")
+	}
+	if filepath.Base(opts.outputfile) != opts.outputfile {
+		return fmt.Errorf(
+			"output file %q must not contain a directory if an output directory is given",
+			opts.outputfile)
+	}
+	if err := os.MkdirAll(opts.outputDir, 0o755); err != nil {
 		return err
 	}
+	opts.outputfile = filepath.Join(opts.outputDir, opts.outputfile)
+	return nil
+}
 
-	if templatefile != "" {
-		overrides, err := fakedoc.LoadTemplate(templatefile)
-		if err != nil {
-			return err
-		}
-		templ.Merge(overrides)
+// newRand creates the random number generator from the seed option. If
+// no seed was given, it returns nil so that the generator uses a random
+// seed.
+func (opts *options) newRand() (*rand.Rand, error) {
+	if opts.seed == "" {
+		return nil, nil
 	}
+	return fakedoc.ParseSeed(opts.seed)
+}
 
+// loadLimits loads the limits file, if given, scales it by the size
+// factor and adds the limits given on the command line. If there are no
+// limits at all, it returns nil.
+func (opts *options) loadLimits() (*fakedoc.Limits, error) {
 	var limits *fakedoc.Limits
-	if limitsfile != "" {
-		if limits, err = fakedoc.LoadLimitsFromFile(limitsfile); err != nil {
+	if opts.limitsfile != "" {
+		var err error
+		if limits, err = fakedoc.LoadLimitsFromFile(opts.limitsfile); err != nil {
+			return nil, err
+		}
+		if opts.sizeFactor != 1.0 {
+			limits = limits.Scale(opts.sizeFactor)
+		}
+	}
+
+	// An empty path applies to all strings or URIs respectively.
+	everywhere := func(length int) []fakedoc.LengthPaths {
+		if length <= 0 {
+			return nil
+		}
+		return []fakedoc.LengthPaths{{
+			Length: length,
+			Paths:  []fakedoc.Path{{}},
+		}}
+	}
+	if opts.limitStrings > 0 || opts.limitURIs > 0 {
+		limits = limits.Merge(&fakedoc.Limits{
+			Strings: everywhere(opts.limitStrings),
+			URIs:    everywhere(opts.limitURIs),
+		})
+	}
+	return limits, nil
+}
+
+// newGenerator creates a generator for the template configured
+// according to the options.
+func (opts *options) newGenerator(
+	templ *fakedoc.Template,
+	limits *fakedoc.Limits,
+) (*fakedoc.Generator, error) {
+	genOpts, err := opts.generatorOptions()
+	if err != nil {
+		return nil, err
+	}
+	rng, err := opts.newRand()
+	if err != nil {
+		return nil, err
+	}
+	genOpts = append(genOpts, fakedoc.WithLimits(limits), fakedoc.WithRand(rng))
+	return fakedoc.NewGenerator(templ, genOpts...), nil
+}
+
+// newGeneratorPool creates a pool of generators for the template
+// configured according to the options, one for each parallel
+// generation.
+func (opts *options) newGeneratorPool(
+	templ *fakedoc.Template,
+	limits *fakedoc.Limits,
+) (*fakedoc.GeneratorPool, error) {
+	genOpts, err := opts.generatorOptions()
+	if err != nil {
+		return nil, err
+	}
+	return fakedoc.NewGeneratorPool(opts.parallel, templ, limits, genOpts...), nil
+}
+
+// generatorOptions returns the generator options for the settings
+// other than the limits and the seed.
+func (opts *options) generatorOptions() ([]fakedoc.GeneratorOption, error) {
+	if opts.maxDepth < 0 {
+		return nil, fmt.Errorf("maximum depth %d is negative", opts.maxDepth)
+	}
+	genOpts := []fakedoc.GeneratorOption{
+		fakedoc.WithSizeFactor(opts.sizeFactor),
+		func(generator *fakedoc.Generator) {
+			generator.ProfilingEnabled = opts.profileGen
+			generator.TemplateVars = opts.vars
+			generator.SizeFactorObjects = !opts.noSizeFactorObjects
+			if opts.verbose {
+				generator.ProgressFunc = printProgress
+			}
+		},
+	}
+	if opts.maxDepth > 0 {
+		genOpts = append(genOpts, fakedoc.WithMaxDepth(opts.maxDepth))
+	}
+	return genOpts, nil
+}
+
+// csafSpecials reports whether the CSAF specific adjustments are
+// applied to the template, so that the documents are CSAF documents.
+func (opts *options) csafSpecials() bool {
+	return opts.schemafile == "" && !opts.noCSAFSpecials
+}
+
+// loadTemplate creates the template from the schema given in the
+// options or from the built-in CSAF schema. The CSAF specific
+// adjustments are only applied to the built-in schema.
+func (opts *options) loadTemplate(
+	schemaOpts []fakedoc.FromSchemaOption,
+) (*fakedoc.Template, error) {
+	if opts.schemafile == "" {
+		return fakedoc.FromCSAFSchema(schemaOpts...)
+	}
+	schema, err := fakedoc.LoadSchemaFromFile(opts.schemafile)
+	if err != nil {
+		return nil, err
+	}
+	schemaOpts = append(schemaOpts, fakedoc.WithoutCSAFSpecials())
+	return fakedoc.FromSchema(schema, schemaOpts...)
+}
+
+func generate(opts *options) (err error) {
+	var schemaOpts []fakedoc.FromSchemaOption
+	if opts.noCSAFSpecials {
+		schemaOpts = append(schemaOpts, fakedoc.WithoutCSAFSpecials())
+	}
+	templ, err := opts.loadTemplate(schemaOpts)
+	if err != nil {
+		return err
+	}
+
+	if err := loadAndMergeTemplates(templ, opts.templatefiles); err != nil {
+		return err
+	}
+
+	if opts.excludeProps != "" {
+		if err := excludeRootProperties(templ, opts.excludeProps); err != nil {
 			return err
 		}
 	}
 
-	generator := fakedoc.NewGenerator(templ, limits, rng)
+	for _, err := range templ.Validate() {
+		if errors.Is(err, fakedoc.ErrFilteredRequired) {
+			log.Printf("warning: %v", err)
+		}
+	}
 
-	if numOutputs == 1 {
-		return generateToFile(generator, outputfile, formatted)
+	if opts.listTypes {
+		for _, info := range templ.ListTypes() {
+			fmt.Printf("%s\t%s\n", info.Name, info.Kind)
+		}
+		return nil
 	}
 
-	tmplFilename, err := template.New("filename").Parse(outputfile)
+	limits, err := opts.loadLimits()
 	if err != nil {
 		return err
 	}
 
-	for n := range numOutputs {
+	zw, closeZip, err := opts.openZip()
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, closeZip()) }()
+
+	if opts.allOfRootOneOf {
+		if oneof, ok := templ.Types[templ.Root].(*fakedoc.TmplOneOf); ok {
+			return generateRootAlternatives(templ, oneof, limits, opts, zw)
+		}
+	}
+
+	if opts.parallel > 1 && opts.numOutputs > 1 {
+		return generateParallel(templ, limits, opts)
+	}
+
+	generator, err := opts.newGenerator(templ, limits)
+	if err != nil {
+		return err
+	}
+	if opts.profileGen {
+		defer func() {
+			fmt.Fprint(os.Stderr, generator.ProfilingReport())
+		}()
+	}
+
+	if opts.format == "jsonl" {
+		return generateJSONLines(generator, opts)
+	}
+
+	if opts.numOutputs == 1 {
+		return generateToFile(generator, opts.outputfile, opts, zw)
+	}
+
+	tmplFilename, err := template.New("filename").Parse(opts.outputfile)
+	if err != nil {
+		return err
+	}
+
+	for n := range opts.numOutputs {
 		filename, err := makeFilename(tmplFilename, n)
 		if err != nil {
 			return err
 		}
-		err = generateToFile(generator, filename, formatted)
+		err = generateToFile(generator, filename, opts, zw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateParallel generates the output files with opts.parallel
+// generators from a pool running concurrently.
+func generateParallel(
+	templ *fakedoc.Template,
+	limits *fakedoc.Limits,
+	opts *options,
+) error {
+	tmplFilename, err := template.New("filename").Parse(opts.outputfile)
+	if err != nil {
+		return err
+	}
+	pool, err := opts.newGeneratorPool(templ, limits)
+	if err != nil {
+		return err
+	}
+
+	numbers := make(chan int)
+	errs := make([]error, opts.parallel)
+	var wg sync.WaitGroup
+	for i := range opts.parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Keep receiving after an error so that the sender
+			// doesn't block.
+			for n := range numbers {
+				if errs[i] != nil {
+					continue
+				}
+				filename, err := makeFilename(tmplFilename, n)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				generator := pool.Acquire()
+				errs[i] = generateToFile(generator, filename, opts, nil)
+				pool.Release(generator)
+			}
+		}()
+	}
+	for n := range opts.numOutputs {
+		numbers <- n
+	}
+	close(numbers)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// loadAndMergeTemplates loads the template files and merges them into
+// templ in order, so that later files take precedence over earlier
+// ones. Each file is merged into the combined template rather than into
+// the previous file, because files may refine types defined only in
+// templ.
+func loadAndMergeTemplates(templ *fakedoc.Template, files []string) error {
+	for _, file := range files {
+		overrides, err := fakedoc.LoadTemplate(file)
 		if err != nil {
 			return err
 		}
+		if err := templ.MergeDeep(overrides); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// excludeRootProperties adds the comma separated property names in
+// names to the property filter of the root type.
+func excludeRootProperties(templ *fakedoc.Template, names string) error {
+	obj, ok := templ.Types[templ.Root].(*fakedoc.TmplObject)
+	if !ok {
+		return fmt.Errorf("root type %q is not an object", templ.Root)
+	}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			obj.PropertyFilter = append(obj.PropertyFilter, name)
+		}
 	}
+	return nil
+}
 
+// generateRootAlternatives generates one document for each of the
+// alternatives of the root type. Each document is generated with a
+// fresh generator using the same seed. If zw is not nil, the documents
+// are written to that zip archive.
+func generateRootAlternatives(
+	templ *fakedoc.Template,
+	oneof *fakedoc.TmplOneOf,
+	limits *fakedoc.Limits,
+	opts *options,
+	zw *zip.Writer,
+) error {
+	if opts.outputfile == "" {
+		return errors.New("generating all root alternatives requires an output file")
+	}
+	if opts.numOutputs > 1 {
+		return errors.New("generating all root alternatives does not support multiple outputs")
+	}
+	if opts.format == "jsonl" {
+		return errors.New("generating all root alternatives does not support format jsonl")
+	}
+	base, found := strings.CutSuffix(opts.outputfile, ".json")
+	if !found {
+		return fmt.Errorf("filename %q doesn't have .json suffix", opts.outputfile)
+	}
+
+	for i, typename := range oneof.OneOf {
+		alternative := *templ
+		alternative.Root = typename
+		generator, err := opts.newGenerator(&alternative, limits)
+		if err != nil {
+			return err
+		}
+		filename := fmt.Sprintf("%s-%d.json", base, i)
+		if err := generateToFile(generator, filename, opts, zw); err != nil {
+			return err
+		}
+		if opts.profileGen {
+			fmt.Fprint(os.Stderr, generator.ProfilingReport())
+		}
+	}
 	return nil
 }
 
@@ -158,17 +801,72 @@ func makeFilename(tmpl *template.Template, n int) (string, error) {
 	return filename.String(), nil
 }
 
+// generateDocument generates a document and reports information about
+// it as requested by the options. Name is the name of the output used
+// in the report.
+func generateDocument(
+	generator *fakedoc.Generator,
+	name string,
+	opts *options,
+) (any, error) {
+	ctx := context.Background()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	doc, err := generator.GenerateWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the reports of documents generated in parallel apart.
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	if opts.verbose {
+		printStatistics(generator, name)
+	}
+	if opts.listNamespaces {
+		listNamespaces(generator)
+	}
+	return doc, nil
+}
+
+// generateJSONLines writes all documents to the output file or stdout
+// as JSON Lines.
+func generateJSONLines(generator *fakedoc.Generator, opts *options) error {
+	out, closeOut, err := openOutput(opts.outputfile, opts.compress)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	var err1 error
+	for range opts.numOutputs {
+		var doc any
+		if doc, err1 = generateDocument(generator, opts.outputfile, opts); err1 != nil {
+			break
+		}
+		if err1 = enc.Encode(doc); err1 != nil {
+			break
+		}
+	}
+	return errors.Join(err1, closeOut())
+}
+
+// generateToFile generates a document and writes it to outputfile. If
+// zw is not nil, outputfile is the name of the document in that zip
+// archive. The tracking ID of CSAF documents is set from outputfile.
 func generateToFile(
 	generator *fakedoc.Generator,
 	outputfile string,
-	formatted bool,
+	opts *options,
+	zw *zip.Writer,
 ) error {
-	csaf, err := generator.Generate()
+	csaf, err := generateDocument(generator, outputfile, opts)
 	if err != nil {
 		return err
 	}
-	if outputfile != "" {
-		id, err := trackingIDFromFilename(outputfile)
+	if outputfile != "" && opts.csafSpecials() {
+		id, err := trackingIDFromFilename(strings.TrimSuffix(outputfile, ".gz"))
 		if err != nil {
 			return err
 		}
@@ -176,7 +874,51 @@ func generateToFile(
 			return fmt.Errorf("setting tracking ID: %w", err)
 		}
 	}
-	return writeJSON(csaf, outputfile, formatted)
+	if zw != nil {
+		return writeJSONToZip(zw, outputfile, csaf, opts.format == "pretty")
+	}
+	out, closeOut, err := openOutput(outputfile, opts.compress)
+	if err != nil {
+		return err
+	}
+	return errors.Join(writeJSON(out, csaf, opts.format), closeOut())
+}
+
+// printStatistics prints information about the document just generated
+// to stderr.
+func printStatistics(generator *fakedoc.Generator, outputfile string) {
+	name := outputfile
+	if name == "" {
+		name = "<stdout>"
+	}
+	fmt.Fprintf(os.Stderr, "generated %s\n", name)
+
+	stats := &generator.Statistics
+	for _, ns := range slices.Sorted(maps.Keys(stats.NamespaceSizes)) {
+		fmt.Fprintf(os.Stderr, "  namespace %s: %d IDs, %d references\n",
+			ns, stats.NamespaceSizes[ns], stats.NamespaceRefCounts[ns])
+	}
+	fmt.Fprintf(os.Stderr, "  maximum depth reached: %d\n", stats.MaxDepthReached)
+	fmt.Fprintf(os.Stderr, "  maximum depth exceeded: %d times\n", stats.DepthExceededCount)
+}
+
+// printProgress reports the number of values generated so far to
+// stderr every progressInterval values.
+func printProgress(event fakedoc.ProgressEvent) {
+	if event.Phase == "node" && event.Count%progressInterval == 0 {
+		fmt.Fprintf(os.Stderr, "  %d values generated\n", event.Count)
+	}
+}
+
+// listNamespaces prints the namespaces of the document just generated
+// to stderr.
+func listNamespaces(generator *fakedoc.Generator) {
+	for _, name := range generator.NamespaceNames() {
+		fmt.Fprintf(os.Stderr, "%s: %d values, %d references\n",
+			name,
+			len(generator.GetNamespaceValues(name)),
+			generator.GetNamespaceRefCount(name))
+	}
 }
 
 func trackingIDFromFilename(filename string) (string, error) {
@@ -188,25 +930,50 @@ func trackingIDFromFilename(filename string) (string, error) {
 	return id, nil
 }
 
-func writeJSON(doc any, outputfile string, formatted bool) error {
+// openOutput creates the output file, or uses stdout if outputfile is
+// empty, and wraps it in a gzip writer if compress is true. In that
+// case '.gz' is appended to the filename unless it already ends with
+// it. The returned function closes the gzip writer and the file.
+func openOutput(outputfile string, compress bool) (io.Writer, func() error, error) {
 	var out io.Writer = os.Stdout
-	var file *os.File
+	closeFile := func() error { return nil }
 	if outputfile != "" {
-		var err error
-		if file, err = os.Create(outputfile); err != nil {
-			return err
+		if compress && !strings.HasSuffix(outputfile, ".gz") {
+			outputfile += ".gz"
 		}
-		out = file
+		file, err := os.Create(outputfile)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, closeFile = file, file.Close
 	}
+	if !compress {
+		return out, closeFile, nil
+	}
+	zw := gzip.NewWriter(out)
+	return zw, func() error { return errors.Join(zw.Close(), closeFile()) }, nil
+}
+
+func writeJSON(out io.Writer, doc any, format string) error {
 	enc := json.NewEncoder(out)
-	if formatted {
+	if format == "pretty" {
 		enc.SetIndent("", "  ")
 	}
-	var err1, err2 error = enc.Encode(doc), nil
-	if file != nil {
-		err2 = file.Close()
+	return enc.Encode(doc)
+}
+
+// writeJSONToZip writes doc as JSON to a new member of the zip archive
+// with the given name. The JSON is indented if formatted is true.
+func writeJSONToZip(zw *zip.Writer, name string, doc any, formatted bool) error {
+	out, err := zw.Create(filepath.ToSlash(name))
+	if err != nil {
+		return err
+	}
+	format := "json"
+	if formatted {
+		format = "pretty"
 	}
-	return errors.Join(err1, err2)
+	return writeJSON(out, doc, format)
 }
 
 func setValue(doc any, path string, value any) error {
@@ -0,0 +1,472 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gocsaf/fakedoc/pkg/fakedoc"
+)
+
+// testOptions returns options with the defaults of the command line
+// flags and a fixed seed.
+func testOptions() options {
+	return options{
+		seed:       "pcg:1:2",
+		numOutputs: 1,
+		format:     "json",
+		sizeFactor: 1.0,
+		parallel:   1,
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	opts := testOptions()
+	opts.numOutputs = 5
+	opts.outputfile = "csaf-{{$}}.json"
+	opts.outputDir = dir
+	if err := opts.applyOutputDir(); err != nil {
+		t.Fatalf("applyOutputDir failed: %v", err)
+	}
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for n := range 5 {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("csaf-%d.json", n))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	opts = testOptions()
+	opts.outputfile = filepath.Join("sub", "csaf.json")
+	opts.outputDir = dir
+	if err := opts.applyOutputDir(); err == nil {
+		t.Error("applyOutputDir accepted an output file with a directory")
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "docs.jsonl")
+	opts := testOptions()
+	opts.numOutputs = 3
+	opts.outputfile = output
+	opts.format = "jsonl"
+	if err := opts.checkFormat(); err != nil {
+		t.Fatalf("checkFormat failed: %v", err)
+	}
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, expected 3", len(lines))
+	}
+	for i, line := range lines {
+		var doc map[string]any
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Errorf("line %d is not a JSON object: %v", i, err)
+		}
+	}
+
+	opts.outputfile = "csaf-{{$}}.json"
+	if err := opts.checkFormat(); err == nil {
+		t.Error("checkFormat accepted jsonl with multiple output files")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions()
+	opts.outputfile = filepath.Join(dir, "plain.json")
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	opts.outputfile = filepath.Join(dir, "compressed.json")
+	opts.compress = true
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate with compression failed: %v", err)
+	}
+
+	plain, err := os.ReadFile(filepath.Join(dir, "plain.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(dir, "compressed.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tracking IDs differ because they're derived from the
+	// filenames.
+	var want, got map[string]any
+	if err := json.Unmarshal(plain, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(decompressed, &got); err != nil {
+		t.Fatalf("decompressed output is not valid JSON: %v", err)
+	}
+	if err := setValue(got, "document/tracking/id", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("compressed document differs from the uncompressed one")
+	}
+}
+
+func TestLoadAndMergeTemplates(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "strings.toml")
+	file2 := filepath.Join(dir, "sizes.toml")
+	for file, data := range map[string]string{
+		file1: `
+[types.name]
+type = "const"
+value = "first"
+
+[types.title]
+type = "const"
+value = "first"
+`,
+		file2: `
+[types.name]
+type = "const"
+value = "second"
+`,
+	} {
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	templ := fakedoc.MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "name"
+type = "name"
+required = true
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+required = true
+
+[types.name]
+type = "string"
+
+[types.title]
+type = "string"
+`)
+	if err := loadAndMergeTemplates(templ, []string{file1, file2}); err != nil {
+		t.Fatalf("loadAndMergeTemplates failed: %v", err)
+	}
+	rng, err := fakedoc.ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fakedoc.MustGenerateJSON(fakedoc.NewGenerator(templ, fakedoc.WithRand(rng)), false)
+	if want := `{"name":"second","title":"first"}`; string(data) != want {
+		t.Errorf("got %s, expected %s", data, want)
+	}
+}
+
+func TestZip(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions()
+	opts.numOutputs = 3
+	opts.outputfile = "doc-{{$}}.json"
+	opts.zipfile = filepath.Join(dir, "docs.zip")
+	if err := opts.checkZip(); err != nil {
+		t.Fatalf("checkZip failed: %v", err)
+	}
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+
+	zr, err := zip.OpenReader(opts.zipfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 3 {
+		t.Fatalf("got %d members, want 3", len(zr.File))
+	}
+	for i, member := range zr.File {
+		want := fmt.Sprintf("doc-%d", i)
+		if member.Name != want+".json" {
+			t.Errorf("member %d is named %q", i, member.Name)
+		}
+		r, err := member.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		err = json.NewDecoder(r).Decode(&doc)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s is not valid JSON: %v", member.Name, err)
+		}
+		tracking := doc["document"].(map[string]any)["tracking"].(map[string]any)
+		if tracking["id"] != want {
+			t.Errorf("%s has tracking ID %v", member.Name, tracking["id"])
+		}
+	}
+
+	opts.compress = true
+	if err := opts.checkZip(); err == nil {
+		t.Error("checkZip accepted --zip with --compress")
+	}
+}
+
+func TestMaxDepthOption(t *testing.T) {
+	templ := &fakedoc.Template{
+		Root:  "root",
+		Types: map[string]fakedoc.TmplNode{"root": &fakedoc.TmplBool{}},
+	}
+	opts := testOptions()
+	gen, err := opts.newGenerator(templ, nil)
+	if err != nil {
+		t.Fatalf("newGenerator failed: %v", err)
+	}
+	if gen.MaxDepth != 25 {
+		t.Errorf("default max depth is %d, want 25", gen.MaxDepth)
+	}
+
+	opts.maxDepth = 50
+	if gen, err = opts.newGenerator(templ, nil); err != nil {
+		t.Fatalf("newGenerator failed: %v", err)
+	}
+	if gen.MaxDepth != 50 {
+		t.Errorf("max depth is %d, want 50", gen.MaxDepth)
+	}
+
+	opts.maxDepth = -1
+	if _, err := opts.newGenerator(templ, nil); err == nil {
+		t.Error("newGenerator accepted a negative max depth")
+	}
+}
+
+func TestLimitStringsOptions(t *testing.T) {
+	templ := &fakedoc.Template{
+		Root: "root",
+		Types: map[string]fakedoc.TmplNode{
+			"root": &fakedoc.TmplObject{
+				Properties: []*fakedoc.Property{
+					{Name: "text", Type: "text", Required: true},
+					{Name: "url", Type: "url", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"text": &fakedoc.TmplString{MinLength: 1, MaxLength: 40},
+			"url":  &fakedoc.TmplString{MinLength: 1, MaxLength: 40, URI: true},
+		},
+	}
+	opts := testOptions()
+	opts.limitStrings = 10
+	opts.limitURIs = 5
+	limits, err := opts.loadLimits()
+	if err != nil {
+		t.Fatalf("loadLimits failed: %v", err)
+	}
+	gen, err := opts.newGenerator(templ, limits)
+	if err != nil {
+		t.Fatalf("newGenerator failed: %v", err)
+	}
+	for range 50 {
+		doc := fakedoc.MustGenerate(gen).(map[string]any)
+		if n := len(doc["text"].(string)); n > 10 {
+			t.Fatalf("string has length %d despite --limit-strings 10", n)
+		}
+		if n := len(doc["url"].(string)); n > 5 {
+			t.Fatalf("URI has length %d despite --limit-uris 5", n)
+		}
+	}
+}
+
+func TestExcludeRootProperties(t *testing.T) {
+	templ := &fakedoc.Template{
+		Root: "root",
+		Types: map[string]fakedoc.TmplNode{
+			"root": &fakedoc.TmplObject{
+				Properties: []*fakedoc.Property{
+					{Name: "a", Type: "value", Required: true},
+					{Name: "b", Type: "value", Required: true},
+					{Name: "c", Type: "value", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"value": &fakedoc.TmplConst{Value: "x"},
+		},
+	}
+	if err := excludeRootProperties(templ, "a, c,"); err != nil {
+		t.Fatalf("excludeRootProperties failed: %v", err)
+	}
+	opts := testOptions()
+	gen, err := opts.newGenerator(templ, nil)
+	if err != nil {
+		t.Fatalf("newGenerator failed: %v", err)
+	}
+	doc := fakedoc.MustGenerate(gen).(map[string]any)
+	if _, ok := doc["b"]; !ok || len(doc) != 1 {
+		t.Errorf("unexpected document %v", doc)
+	}
+
+	templ.Root = "value"
+	if err := excludeRootProperties(templ, "a"); err == nil {
+		t.Error("excludeRootProperties accepted a root that is not an object")
+	}
+}
+
+func TestSchemaOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	schemafile := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schemafile, []byte(`{
+  "type": "object",
+  "properties": {"name": {"type": "string", "enum": ["x"]}},
+  "required": ["name"]
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.schemafile = schemafile
+	opts.outputfile = filepath.Join(dir, "doc.json")
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	data, err := os.ReadFile(opts.outputfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"name": "x"}; !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %v, want %v", doc, want)
+	}
+}
+
+func TestAllOfRootOneOfSchema(t *testing.T) {
+	dir := t.TempDir()
+	schemafile := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schemafile, []byte(`{
+  "oneOf": [
+    {
+      "type": "object",
+      "properties": {"a": {"type": "string", "enum": ["x"]}},
+      "required": ["a"]
+    },
+    {
+      "type": "object",
+      "properties": {"b": {"type": "string", "enum": ["y"]}},
+      "required": ["b"]
+    }
+  ]
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.schemafile = schemafile
+	opts.outputfile = filepath.Join(dir, "out.json")
+	opts.allOfRootOneOf = true
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for i, want := range []map[string]any{{"a": "x"}, {"b": "y"}} {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("out-%d.json", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(doc, want) {
+			t.Errorf("alternative %d: got %v, want %v", i, doc, want)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions()
+	opts.seed = ""
+	opts.numOutputs = 6
+	opts.parallel = 3
+	opts.outputfile = filepath.Join(dir, "csaf-{{$}}.json")
+	if err := opts.checkParallel(); err != nil {
+		t.Fatalf("checkParallel failed: %v", err)
+	}
+	if err := generate(&opts); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	for n := range 6 {
+		data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("csaf-%d.json", n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Document struct {
+				Tracking struct {
+					ID string `json:"id"`
+				} `json:"tracking"`
+			} `json:"document"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("document %d: %v", n, err)
+		}
+		if want := fmt.Sprintf("csaf-%d", n); doc.Document.Tracking.ID != want {
+			t.Errorf("document %d has tracking ID %q, want %q", n, doc.Document.Tracking.ID, want)
+		}
+	}
+
+	for _, modify := range []func(*options){
+		func(o *options) { o.parallel = 0 },
+		func(o *options) { o.seed = "pcg:1:2" },
+		func(o *options) { o.format = "jsonl" },
+		func(o *options) { o.zipfile = "docs.zip" },
+		func(o *options) { o.profileGen = true },
+		func(o *options) { o.allOfRootOneOf = true },
+	} {
+		o := opts
+		modify(&o)
+		if err := o.checkParallel(); err == nil {
+			t.Errorf("checkParallel accepted %+v", o)
+		}
+	}
+}
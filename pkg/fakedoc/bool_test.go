@@ -0,0 +1,104 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBoolProbability(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		probability float64
+		want        bool
+	}{
+		{0.0, false},
+		{1.0, true},
+	} {
+		templ := &Template{
+			Root:  "flag",
+			Types: map[string]TmplNode{"flag": &TmplBool{Probability: tc.probability}},
+		}
+		gen := NewGenerator(templ, WithRand(rng))
+		for range 50 {
+			value, err := gen.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if value != tc.want {
+				t.Errorf("probability %g: got %v, want %v",
+					tc.probability, value, tc.want)
+			}
+		}
+	}
+}
+
+func TestBoolRoundTrip(t *testing.T) {
+	templ := &Template{
+		Root: "flags",
+		Types: map[string]TmplNode{
+			"flags": &TmplArray{
+				Items:              "flag",
+				MinItems:           -1,
+				MaxItems:           -1,
+				LengthDistribution: LengthUniform,
+			},
+			"flag": &TmplBool{Probability: 0.7},
+		},
+	}
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	flag, ok := loaded.Types["flag"].(*TmplBool)
+	if !ok {
+		t.Fatalf("flag type is %T, expected *TmplBool", loaded.Types["flag"])
+	}
+	if flag.Probability != 0.7 {
+		t.Errorf("probability is %g, expected 0.7", flag.Probability)
+	}
+
+	defaulted, err := ParseTemplate(`
+[types.flag]
+type = "bool"
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	if p := defaulted.Types["flag"].(*TmplBool).Probability; p != 0.5 {
+		t.Errorf("default probability is %g, expected 0.5", p)
+	}
+
+	if _, err := ParseTemplate(`
+[types.flag]
+type = "bool"
+probability = 2
+`); err == nil {
+		t.Error("ParseTemplate accepted probability > 1")
+	}
+}
+
+func TestBoolFromSchema(t *testing.T) {
+	templ, err := fromTestSchema(
+		[]byte(`{"type": "boolean"}`), "https://example.com/bool.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	if _, ok := templ.Types[templ.Root].(*TmplBool); !ok {
+		t.Errorf("root type is %T, expected *TmplBool", templ.Types[templ.Root])
+	}
+}
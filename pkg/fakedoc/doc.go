@@ -0,0 +1,35 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+// Package fakedoc contains code to generate random fake CSAF files.
+//
+// The structure of the generated documents is described by a
+// [Template]. A template maps type names to template nodes
+// ([TmplNode]), each of which describes how to generate one kind of
+// JSON value, e.g. an object with certain properties ([TmplObject]),
+// an array ([TmplArray]) or a string matching a regular expression
+// ([TmplString]). The Root field of the template names the type of the
+// generated document. A default template can be derived from the
+// built-in CSAF JSON schema with [FromCSAFSchema] and then be modified
+// by merging templates loaded from TOML files with [LoadTemplate].
+//
+// A [Generator] instantiates the template. All random decisions are
+// made with the generator's random number generator, so that a
+// generator created with a fixed seed, e.g. one obtained from
+// [ParseSeed], always produces the same documents. Optionally, the
+// generator can be given [Limits] which describe the maximum sizes of
+// the parts of a CSAF document.
+//
+// IDs that are defined in one place of the document and referenced in
+// other places, like product IDs, are generated by [TmplID] and
+// [TmplRef] nodes. Both use namespaces so that there can be several
+// independent kinds of IDs. The generator collects the IDs of each
+// namespace while generating the document and fills in the references
+// once the whole document has been generated, so that references only
+// point to IDs that actually exist in the document.
+package fakedoc
@@ -0,0 +1,154 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gocsaf/fakedoc/pkg/fakedoc"
+)
+
+func ExampleNewGenerator() {
+	minimum, maximum := float32(0), float32(10)
+	templ := &fakedoc.Template{
+		Root: "score",
+		Types: map[string]fakedoc.TmplNode{
+			"score": &fakedoc.TmplObject{
+				Properties: []*fakedoc.Property{
+					{Name: "vendor", Type: "vendor", Required: true},
+					{Name: "value", Type: "value", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"vendor": &fakedoc.TmplString{
+				Enum: []string{"CSAF, Inc."},
+			},
+			"value": &fakedoc.TmplNumber{
+				Minimum: &minimum,
+				Maximum: &maximum,
+			},
+		},
+	}
+
+	rng, err := fakedoc.ParseSeed("pcg:1:2")
+	if err != nil {
+		log.Fatal(err)
+	}
+	gen := fakedoc.NewGenerator(templ, fakedoc.WithRand(rng))
+	doc, err := gen.Generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(doc.(map[string]any)["vendor"])
+	// Output: CSAF, Inc.
+}
+
+func ExampleGenerator_Generate() {
+	templ := &fakedoc.Template{
+		Root: "doc",
+		Types: map[string]fakedoc.TmplNode{
+			"doc": &fakedoc.TmplObject{
+				Properties: []*fakedoc.Property{
+					{Name: "products", Type: "products", Required: true},
+					{Name: "fixed", Type: "product_ref", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"products": &fakedoc.TmplArray{
+				Items:    "product_id",
+				MinItems: 3,
+				MaxItems: 3,
+			},
+			"product_id":  &fakedoc.TmplID{Namespace: "product"},
+			"product_ref": &fakedoc.TmplRef{Namespace: "product"},
+		},
+	}
+
+	rng, err := fakedoc.ParseSeed("pcg:1:2")
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc, err := fakedoc.NewGenerator(templ, fakedoc.WithRand(rng)).Generate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(out))
+	// Output:
+	// {"fixed":"TFdtcNmauRTY7CKP","products":["WXnbEBhkOB6gx","TFdtcNmauRTY7CKP"," L6Rfw30xRc"]}
+}
+
+func ExampleFromCSAFSchema() {
+	templ, err := fakedoc.FromCSAFSchema()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(templ.Root)
+	fmt.Printf("%T\n", templ.Types["csaf:#/$defs/product_id_t"])
+	// Output:
+	// csaf:#
+	// *fakedoc.TmplRef
+}
+
+func ExampleCompileRegexp() {
+	pattern, err := fakedoc.CompileRegexp("^CVE-[0-9]{4}-[0-9]{4,6}$")
+	if err != nil {
+		log.Fatal(err)
+	}
+	rng, err := fakedoc.ParseSeed("pcg:1:2")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(pattern.Sample(rng))
+	// Output: CVE-7677-0441
+}
+
+func ExampleMustGenerateJSON() {
+	templ := fakedoc.MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "status"
+type = "status"
+required = true
+
+[types.status]
+type = "string"
+enum = ["final"]
+`)
+	rng, err := fakedoc.ParseSeed("pcg:1:2")
+	if err != nil {
+		log.Fatal(err)
+	}
+	gen := fakedoc.NewGenerator(templ, fakedoc.WithRand(rng))
+	fmt.Println(string(fakedoc.MustGenerateJSON(gen, false)))
+	// Output: {"status":"final"}
+}
+
+func ExampleSchemaVersion() {
+	fmt.Println(fakedoc.SchemaVersion())
+	for _, flavor := range []string{"2.0", "3.0", "3.1"} {
+		fmt.Println(fakedoc.CVSSSchemaVersion(flavor))
+	}
+	// Output:
+	// 2.0
+	// 2.0
+	// 3.0
+	// 3.1
+}
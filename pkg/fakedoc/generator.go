@@ -9,22 +9,33 @@
 package fakedoc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"math"
 	"math/rand/v2"
 	"os"
 	"reflect"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/go-loremipsum/loremipsum"
 )
 
+// maxDepth is the default maximum nesting depth of generated documents
+const maxDepth = 25
+
+// maxDocumentAttempts is the number of documents generated at most to
+// find one that matches Generator.RequireRegex
+const maxDocumentAttempts = 20
+
 // ErrBranchAbandoned is the base errors that indicate that the
 // generator should abandon a recursive descent and try again with a
 // different branch.
@@ -51,6 +62,10 @@ var ErrNoValidValue = fmt.Errorf("%w: could not generate valid value", ErrBranch
 // file not a text document.
 var ErrInvalidString = errors.New("not valid utf-8")
 
+// ErrNoTemplate is returned as error by Generate if the generator was
+// created without a template.
+var ErrNoTemplate = errors.New("generator has no template")
+
 // Generator is the type of CSAF document generators
 type Generator struct {
 	Template   *Template
@@ -58,6 +73,172 @@ type Generator struct {
 	Rand       *rand.Rand
 	FileCache  map[string]string
 	NameSpaces map[string]*NameSpace
+
+	// TemplateVars holds the values of the variables used by TmplVarRef
+	// nodes. Missing variables have the empty string as value.
+	TemplateVars map[string]string
+
+	// MemoizeTypes contains the names of types for which a value is
+	// only generated once per document. Subsequent uses of the type in
+	// the same document reuse that value. This must only be used for
+	// types whose values do not contain IDs or references.
+	MemoizeTypes []string
+
+	// MaxItemAttempts is the number of attempts to generate a value
+	// that satisfies additional constraints, such as unique array items
+	// or strings that must not match a blacklist.
+	MaxItemAttempts int
+
+	// StubDepthThreshold is the remaining depth below which objects
+	// with the Stub flag are generated with as few properties as
+	// possible.
+	StubDepthThreshold int
+
+	// DepthSizeReductionThreshold is the remaining depth below which
+	// the maximum length of arrays is reduced proportionally to the
+	// remaining depth, but not below their minimum length. Setting it
+	// to 0 disables the reduction.
+	DepthSizeReductionThreshold int
+
+	// SizeFactor scales the size of the generated documents. Values
+	// below 1 lead to smaller documents. Currently it limits the number
+	// of optional properties of objects without an explicit maximum
+	// number of properties if SizeFactorObjects is true.
+	SizeFactor float64
+
+	// SizeFactorObjects indicates whether SizeFactor applies to objects
+	// without an explicit maximum number of properties. If false, such
+	// objects may have all of their properties.
+	SizeFactorObjects bool
+
+	// ForceMaxSize makes arrays and objects as large as their bounds
+	// allow. Arrays get their maximum number of items and objects as
+	// many optional properties as their maximum number of properties
+	// permits.
+	ForceMaxSize bool
+
+	// OptionalProbability, if greater than 0, is the probability with
+	// which each optional property is generated for objects without a
+	// SkipProbability of their own. If it's 0, the number of optional
+	// properties is chosen uniformly between the bounds of the object.
+	OptionalProbability float64
+
+	// RequireRegex, if not nil, is a regular expression that the JSON
+	// encoding of the generated documents must match. Documents that
+	// don't match are discarded. If none of maxDocumentAttempts
+	// documents match, Generate fails with ErrNoValidValue.
+	RequireRegex *regexp.Regexp
+
+	// MaxDepth is the maximum nesting depth of generated documents
+	MaxDepth int
+
+	// ArrayLimits is the tree of the array length limits of Limits.
+	// Arrays are not generated with more items than the limits allow.
+	ArrayLimits *LimitNode
+
+	// StringLimits is the tree of the string length limits of Limits.
+	// They reduce the maximum length of strings.
+	StringLimits *LimitNode
+
+	// URILimits is the tree of the URI length limits of Limits. They
+	// reduce the maximum length of strings marked as URIs.
+	URILimits *LimitNode
+
+	// Statistics holds information about the last generated document
+	Statistics Statistics
+
+	// ProfilingEnabled indicates whether the time spent generating
+	// values is recorded for each type. See ProfilingReport.
+	ProfilingEnabled bool
+
+	// ProgressFunc, if not nil, is called frequently while a document
+	// is generated. See ProgressEvent for the kinds of events. It's
+	// called very often, so it should return quickly.
+	ProgressFunc func(event ProgressEvent)
+
+	ctx       context.Context
+	profile   profile
+	memoCache map[string]any
+	// memoOrder contains the names of the types in memoCache in the
+	// order in which their values were cached
+	memoOrder    []string
+	singletons   map[string]any
+	dependencies map[string]Dependencies
+	nsChanges    []namespaceChange
+	validated    bool
+	nodeCount    int
+	limits       limitNodes
+	// omitProperty is the name of a property that the next object
+	// generated must not have. See groupItem.
+	omitProperty string
+}
+
+// limitNodes holds the nodes of the limit trees that apply to the
+// value currently being generated.
+type limitNodes struct {
+	arrays  *LimitNode
+	strings *LimitNode
+	uris    *LimitNode
+}
+
+// descend returns the nodes for the property name.
+func (ln limitNodes) descend(name string) limitNodes {
+	return limitNodes{
+		arrays:  ln.arrays.Descend(name),
+		strings: ln.strings.Descend(name),
+		uris:    ln.uris.Descend(name),
+	}
+}
+
+// stringLimit returns the length limit for a string. The URI limit only
+// applies if uri is true.
+func (ln limitNodes) stringLimit(uri bool) int {
+	limit := ln.strings.GetLimit()
+	if uri {
+		limit = minLimit(limit, ln.uris.GetLimit())
+	}
+	return limit
+}
+
+// ProgressEvent describes the progress of the generation of a document.
+// Phase indicates what kind of event it is and determines the meaning
+// of the other fields:
+//
+//   - "node": A value of the type TypeName is about to be generated.
+//     Count is the number of values generated so far for the document
+//     including this one.
+//   - "array_item": An item of the type TypeName is about to be
+//     generated for an array. Count is the number of items the array
+//     already has.
+//   - "fixup": The references to the IDs of the namespace TypeName are
+//     resolved. Count is the number of references.
+//
+// Depth is the nesting depth at which the value is generated. It's 0
+// for the fixup phase.
+type ProgressEvent struct {
+	Phase    string
+	TypeName string
+	Depth    int
+	Count    int
+}
+
+// Statistics holds information about a generated document
+type Statistics struct {
+	// NamespaceSizes maps namespace names to the number of IDs
+	// generated in the namespace
+	NamespaceSizes map[string]int
+
+	// NamespaceRefCounts maps namespace names to the number of
+	// references to IDs of the namespace that were resolved
+	NamespaceRefCounts map[string]int
+
+	// MaxDepthReached is the largest nesting depth at which a value
+	// was generated successfully
+	MaxDepthReached int
+
+	// DepthExceededCount is the number of times the generation of a
+	// value failed because the maximum depth would have been exceeded
+	DepthExceededCount int64
 }
 
 // NameSpace helps implement TmplID and TmplRef by collecting the IDs
@@ -77,11 +258,24 @@ func (ns *NameSpace) addRef(r *reference) {
 	ns.Refs = append(ns.Refs, r)
 }
 
-func (ns *NameSpace) snapshot() *NameSpace {
-	return &NameSpace{
-		Values: ns.Values,
-		Refs:   ns.Refs,
-	}
+// namespaceChange records the state of a namespace before it was
+// changed, so that the change can be undone.
+type namespaceChange struct {
+	namespace string
+	// created indicates that the namespace was created by the change
+	created bool
+	// values and refs are the numbers of values and references in the
+	// namespace before the change
+	values, refs int
+}
+
+// namespaceSnapshot identifies a state of the namespaces and the memo
+// cache that can be restored with restoreSnapshot. It holds the number
+// of changes made to the namespaces and the number of values memoized
+// up to that state.
+type namespaceSnapshot struct {
+	changes  int
+	memoized int
 }
 
 // reference is the value of a node created for TmplRef or arrays of
@@ -104,42 +298,213 @@ func (ref *reference) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ref.values)
 }
 
-// NewGenerator creates a new Generator based on a Template and an
-// optional random number generator. If the random number generator is
-// nil, a random number generator with a random seed will be used.
-// Limits is an optional limits guidance.
-func NewGenerator(
+// GeneratorOption configures a Generator created by NewGenerator
+type GeneratorOption func(*Generator)
+
+// WithLimits sets the limits guidance of the generator
+func WithLimits(limits *Limits) GeneratorOption {
+	return func(gen *Generator) {
+		gen.Limits = limits
+	}
+}
+
+// WithRand sets the random number generator of the generator. If rng
+// is nil, a random number generator with a random seed is used.
+func WithRand(rng *rand.Rand) GeneratorOption {
+	return func(gen *Generator) {
+		gen.Rand = rng
+	}
+}
+
+// WithSizeFactor sets the SizeFactor of the generator
+func WithSizeFactor(factor float64) GeneratorOption {
+	return func(gen *Generator) {
+		gen.SizeFactor = factor
+	}
+}
+
+// WithForceMaxSize sets the ForceMaxSize flag of the generator
+func WithForceMaxSize(force bool) GeneratorOption {
+	return func(gen *Generator) {
+		gen.ForceMaxSize = force
+	}
+}
+
+// WithOptionalProbability sets the OptionalProbability of the generator
+func WithOptionalProbability(probability float64) GeneratorOption {
+	return func(gen *Generator) {
+		gen.OptionalProbability = probability
+	}
+}
+
+// WithRequireRegex sets the RequireRegex of the generator
+func WithRequireRegex(re *regexp.Regexp) GeneratorOption {
+	return func(gen *Generator) {
+		gen.RequireRegex = re
+	}
+}
+
+// WithMaxDepth sets the maximum nesting depth of generated documents
+func WithMaxDepth(depth int) GeneratorOption {
+	return func(gen *Generator) {
+		gen.MaxDepth = depth
+	}
+}
+
+// NewGenerator creates a new Generator based on a Template configured
+// with the given options. Without options the generator has no limits,
+// a maximum depth of 25 and uses a random number generator with a
+// random seed.
+//
+// The default SizeFactor is 1.0, not the 0.00001 of
+// GeneratorOptions.Defaults. It matches the default of the
+// --size-factor option of fakedoc, and a smaller default would make
+// generators of existing callers only generate minimal documents.
+//
+// The template is not validated here but by the first call of Generate
+// or GenerateWithContext, which fails if the template is invalid. Call
+// Template.Validate to check the template before creating a generator.
+func NewGenerator(tmpl *Template, opts ...GeneratorOption) *Generator {
+	gen := &Generator{
+		Template:   tmpl,
+		FileCache:  make(map[string]string),
+		NameSpaces: make(map[string]*NameSpace),
+
+		MaxItemAttempts:             10,
+		StubDepthThreshold:          3,
+		DepthSizeReductionThreshold: 5,
+		SizeFactor:                  1.0,
+		SizeFactorObjects:           true,
+		MaxDepth:                    maxDepth,
+	}
+	if tmpl != nil {
+		gen.MemoizeTypes = slices.Clone(tmpl.MemoizeTypes)
+	}
+	for _, opt := range opts {
+		opt(gen)
+	}
+	if gen.Rand == nil {
+		gen.Rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	gen.ArrayLimits = gen.Limits.ArrayLimits()
+	gen.StringLimits = gen.Limits.StringLimits()
+	gen.URILimits = gen.Limits.URILimits()
+	return gen
+}
+
+// NewGeneratorLegacy creates a new Generator with the parameters that
+// NewGenerator used to take.
+//
+// Deprecated: Use NewGenerator with WithLimits and WithRand instead.
+func NewGeneratorLegacy(
 	tmpl *Template,
 	limits *Limits,
 	rng *rand.Rand,
 ) *Generator {
-	if rng == nil {
-		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	return NewGenerator(tmpl, WithLimits(limits), WithRand(rng))
+}
+
+// GeneratorOptions holds the configuration of a generator for
+// NewGeneratorFromOptions. Fields with zero values get the same
+// defaults as with NewGenerator. Defaults returns a different set of
+// values meant for generating small documents.
+type GeneratorOptions struct {
+	// Template is the template of the generated documents
+	Template *Template
+	// Limits is the limits guidance. It may be nil.
+	Limits *Limits
+	// SizeFactor scales the size of the documents, see
+	// Generator.SizeFactor.
+	SizeFactor float64
+	// ForceMaxSize makes arrays and objects as large as possible, see
+	// Generator.ForceMaxSize.
+	ForceMaxSize bool
+	// Rand is the random number generator. The default uses a random
+	// seed.
+	Rand *rand.Rand
+	// RequireRegex is a regular expression the JSON encoding of the
+	// documents must match, see Generator.RequireRegex. It may be nil.
+	RequireRegex *regexp.Regexp
+	// MaxDepth is the maximum nesting depth of the documents.
+	MaxDepth int
+	// OptionalProbability is the probability with which optional
+	// properties are generated, see Generator.OptionalProbability.
+	OptionalProbability float64
+}
+
+// Defaults returns a copy of opts with values for small documents
+// filled in for the fields with zero values, except for Template,
+// Limits, ForceMaxSize and RequireRegex: a SizeFactor of 0.00001, which
+// leads to minimal documents, a MaxDepth of 25, an OptionalProbability
+// of 0.5 and a random number generator with a random seed.
+// NewGeneratorFromOptions doesn't apply these values by itself.
+func (opts GeneratorOptions) Defaults() GeneratorOptions {
+	if opts.SizeFactor == 0 {
+		opts.SizeFactor = 0.00001
 	}
-	return &Generator{
-		Template:   tmpl,
-		Limits:     limits,
-		Rand:       rng,
-		FileCache:  make(map[string]string),
-		NameSpaces: make(map[string]*NameSpace),
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = maxDepth
 	}
+	if opts.OptionalProbability == 0 {
+		opts.OptionalProbability = 0.5
+	}
+	return opts
+}
+
+// NewGeneratorFromOptions creates a new Generator configured with opts.
+// It's equivalent to NewGenerator with the options for the fields with
+// non-zero values. Use opts.Defaults() to get small documents instead.
+func NewGeneratorFromOptions(opts GeneratorOptions) *Generator {
+	genOpts := []GeneratorOption{
+		WithLimits(opts.Limits),
+		WithRand(opts.Rand),
+		WithForceMaxSize(opts.ForceMaxSize),
+		WithRequireRegex(opts.RequireRegex),
+		WithOptionalProbability(opts.OptionalProbability),
+	}
+	if opts.SizeFactor != 0 {
+		genOpts = append(genOpts, WithSizeFactor(opts.SizeFactor))
+	}
+	if opts.MaxDepth != 0 {
+		genOpts = append(genOpts, WithMaxDepth(opts.MaxDepth))
+	}
+	return NewGenerator(opts.Template, genOpts...)
 }
 
 func (gen *Generator) getNamespace(namespace string) *NameSpace {
 	if _, ok := gen.NameSpaces[namespace]; !ok {
 		gen.NameSpaces[namespace] = &NameSpace{}
+		gen.nsChanges = append(gen.nsChanges, namespaceChange{
+			namespace: namespace,
+			created:   true,
+		})
 	}
 	return gen.NameSpaces[namespace]
 }
 
+// changeNamespace returns the namespace after recording its current
+// state in the change log.
+func (gen *Generator) changeNamespace(namespace string) *NameSpace {
+	ns := gen.getNamespace(namespace)
+	gen.nsChanges = append(gen.nsChanges, namespaceChange{
+		namespace: namespace,
+		values:    len(ns.Values),
+		refs:      len(ns.Refs),
+	})
+	return ns
+}
+
 // addNSValue adds a value to a namespace
 func (gen *Generator) addNSValue(namespace, v string) {
-	gen.getNamespace(namespace).addValue(v)
+	gen.changeNamespace(namespace).addValue(v)
 }
 
 // adNSRef adds a reference to a namespace
 func (gen *Generator) adNSRef(namespace string, r *reference) {
-	gen.getNamespace(namespace).addRef(r)
+	gen.changeNamespace(namespace).addRef(r)
 }
 
 func (gen *Generator) hasNSValues(namespace string) bool {
@@ -150,21 +515,121 @@ func (gen *Generator) numNSValues(namespace string) int {
 	return len(gen.getNamespace(namespace).Values)
 }
 
-func (gen *Generator) snapshotNamespaces() map[string]*NameSpace {
-	snap := make(map[string]*NameSpace, len(gen.NameSpaces))
+// NamespaceNames returns the sorted names of all namespaces that have
+// IDs or references.
+func (gen *Generator) NamespaceNames() []string {
+	var names []string
 	for name, ns := range gen.NameSpaces {
-		snap[name] = ns.snapshot()
+		if len(ns.Values) > 0 || len(ns.Refs) > 0 {
+			names = append(names, name)
+		}
 	}
-	return snap
+	slices.Sort(names)
+	return names
 }
 
-func (gen *Generator) restoreSnapshot(snapshot map[string]*NameSpace) {
-	gen.NameSpaces = snapshot
+// GetNamespaceValues returns a copy of the IDs generated for a
+// namespace.
+func (gen *Generator) GetNamespaceValues(name string) []string {
+	if ns, ok := gen.NameSpaces[name]; ok {
+		return slices.Clone(ns.Values)
+	}
+	return nil
 }
 
-// Generate generates a document
+// GetNamespaceRefCount returns the number of references to IDs of a
+// namespace. A reference to multiple IDs counts only once.
+func (gen *Generator) GetNamespaceRefCount(name string) int {
+	if ns, ok := gen.NameSpaces[name]; ok {
+		return len(ns.Refs)
+	}
+	return 0
+}
+
+// snapshotNamespaces returns a snapshot of the current state of the
+// namespaces and the memo cache. As all changes to the namespaces are
+// recorded in a log, the snapshot is just the current length of the
+// log and of the list of memoized types.
+func (gen *Generator) snapshotNamespaces() namespaceSnapshot {
+	return namespaceSnapshot{
+		changes:  len(gen.nsChanges),
+		memoized: len(gen.memoOrder),
+	}
+}
+
+// restoreSnapshot undoes all changes made to the namespaces after the
+// snapshot was taken, latest first, and discards the values memoized
+// since then, which may contain IDs that are no longer in the
+// namespaces.
+func (gen *Generator) restoreSnapshot(snapshot namespaceSnapshot) {
+	for _, typename := range gen.memoOrder[snapshot.memoized:] {
+		delete(gen.memoCache, typename)
+	}
+	gen.memoOrder = gen.memoOrder[:snapshot.memoized]
+	for i := len(gen.nsChanges) - 1; i >= snapshot.changes; i-- {
+		change := gen.nsChanges[i]
+		if change.created {
+			delete(gen.NameSpaces, change.namespace)
+			continue
+		}
+		ns := gen.NameSpaces[change.namespace]
+		ns.Values = ns.Values[:change.values]
+		ns.Refs = ns.Refs[:change.refs]
+	}
+	if snapshot.changes < len(gen.nsChanges) {
+		gen.nsChanges = gen.nsChanges[:snapshot.changes]
+	}
+}
+
+// Generate generates a document. The first call validates the template
+// and fails with all problems found if it's invalid.
 func (gen *Generator) Generate() (any, error) {
-	doc, err := gen.generateNode(gen.Template.Root, 25)
+	return gen.GenerateWithContext(context.Background())
+}
+
+// GenerateWithContext is like Generate but stops generating the
+// document when ctx is done. The error returned in that case wraps
+// ctx.Err().
+func (gen *Generator) GenerateWithContext(ctx context.Context) (any, error) {
+	gen.ctx = ctx
+	defer func() { gen.ctx = nil }()
+	if gen.Template == nil {
+		return nil, ErrNoTemplate
+	}
+	if !gen.validated {
+		errs := slices.DeleteFunc(gen.Template.Validate(), func(err error) bool {
+			return errors.Is(err, ErrFilteredRequired)
+		})
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		gen.validated = true
+	}
+	if gen.RequireRegex == nil {
+		return gen.generateDocument()
+	}
+	for range maxDocumentAttempts {
+		doc, err := gen.generateDocument()
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if gen.RequireRegex.Match(data) {
+			return doc, nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"no document matches %q: %w", gen.RequireRegex, ErrNoValidValue,
+	)
+}
+
+// generateDocument resets the generator and generates a document.
+func (gen *Generator) generateDocument() (any, error) {
+	gen.Reset()
+	doc, err := gen.generateNode(gen.Template.Root, gen.MaxDepth)
 	if err != nil {
 		return nil, err
 	}
@@ -172,14 +637,102 @@ func (gen *Generator) Generate() (any, error) {
 	if err = gen.fixupReferences(); err != nil {
 		return nil, err
 	}
+	gen.collectNamespaceStatistics()
 
 	return doc, nil
 }
 
+// GenerateJSON generates a document and returns it encoded as JSON,
+// indented if formatted is true.
+func (gen *Generator) GenerateJSON(formatted bool) ([]byte, error) {
+	doc, err := gen.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if formatted {
+		return json.MarshalIndent(doc, "", "  ")
+	}
+	return json.Marshal(doc)
+}
+
+// GenerateWriter generates a document and writes it as JSON to w,
+// indented if formatted is true.
+func (gen *Generator) GenerateWriter(w io.Writer, formatted bool) error {
+	doc, err := gen.Generate()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	if formatted {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(doc)
+}
+
+// MustGenerate is like Generate but panics if the document cannot be
+// generated. It is intended for test setup code, e.g. in TestMain or
+// init functions, where errors cannot be returned. Do not use it in
+// production code.
+func MustGenerate(gen *Generator) any {
+	doc, err := gen.Generate()
+	if err != nil {
+		panic(`fakedoc: Generate: ` + err.Error())
+	}
+	return doc
+}
+
+// MustGenerateJSON generates a document and returns it encoded as JSON,
+// indented if formatted is true. It panics if the document cannot be
+// generated or encoded. Like MustGenerate it is only intended for test
+// code.
+func MustGenerateJSON(gen *Generator, formatted bool) []byte {
+	data, err := gen.GenerateJSON(formatted)
+	if err != nil {
+		panic(`fakedoc: MustGenerateJSON: ` + err.Error())
+	}
+	return data
+}
+
+func (gen *Generator) collectNamespaceStatistics() {
+	sizes := make(map[string]int, len(gen.NameSpaces))
+	refCounts := make(map[string]int, len(gen.NameSpaces))
+	for name, ns := range gen.NameSpaces {
+		sizes[name] = len(ns.Values)
+		refCounts[name] = len(ns.Refs)
+	}
+	gen.Statistics.NamespaceSizes = sizes
+	gen.Statistics.NamespaceRefCounts = refCounts
+}
+
 func (gen *Generator) generateNode(typename string, depth int) (_ any, err error) {
+	if gen.ctx != nil {
+		if err := gen.ctx.Err(); err != nil {
+			return nil, fmt.Errorf("generation stopped: %w", err)
+		}
+	}
+	if gen.ProgressFunc != nil {
+		gen.nodeCount++
+		gen.ProgressFunc(ProgressEvent{
+			Phase:    "node",
+			TypeName: typename,
+			Depth:    gen.MaxDepth - depth,
+			Count:    gen.nodeCount,
+		})
+	}
 	if depth <= 0 {
+		gen.Statistics.DepthExceededCount++
 		return nil, ErrDepthExceeded
 	}
+	defer func() {
+		if err == nil {
+			gen.Statistics.MaxDepthReached = max(
+				gen.Statistics.MaxDepthReached, gen.MaxDepth-depth,
+			)
+		}
+	}()
+	if gen.ProfilingEnabled {
+		defer gen.profile.record(typename, time.Now())
+	}
 	// make sure IDs generated in abandoned branches are discarded so
 	// that we don't end up with e.g. references to group IDs that are
 	// not actually there.
@@ -189,10 +742,78 @@ func (gen *Generator) generateNode(typename string, depth int) (_ any, err error
 			gen.restoreSnapshot(snapshot)
 		}
 	}()
-	if nodeTmpl := gen.Template.Types[typename]; nodeTmpl != nil {
-		return nodeTmpl.Instantiate(gen, depth)
+	memoize := slices.Contains(gen.MemoizeTypes, typename)
+	if memoize {
+		if value, ok := gen.memoCache[typename]; ok {
+			return value, nil
+		}
+	}
+	nodeTmpl := gen.Template.Types[typename]
+	if nodeTmpl == nil {
+		return nil, fmt.Errorf("unknown type %q", typename)
+	}
+	obj, singleton := nodeTmpl.(*TmplObject)
+	singleton = singleton && obj.Singleton
+	if singleton {
+		if value, ok := gen.singletons[typename]; ok {
+			return value, nil
+		}
+	}
+	value, err := nodeTmpl.Instantiate(gen, depth)
+	if err != nil {
+		return value, err
+	}
+	if memoize {
+		if gen.memoCache == nil {
+			gen.memoCache = make(map[string]any)
+		}
+		gen.memoCache[typename] = value
+		gen.memoOrder = append(gen.memoOrder, typename)
+	}
+	if singleton {
+		if gen.singletons == nil {
+			gen.singletons = make(map[string]any)
+		}
+		gen.singletons[typename] = value
+	}
+	return value, nil
+}
+
+// ClearMemoCache discards the values cached for the types in
+// MemoizeTypes. This happens automatically at the start of Generate.
+func (gen *Generator) ClearMemoCache() {
+	clear(gen.memoCache)
+	gen.memoOrder = gen.memoOrder[:0]
+}
+
+// Reset discards all state accumulated while generating a document,
+// i.e. the namespaces, the memoized values, the values of singleton
+// objects, the cached type dependencies and the statistics. This
+// happens automatically at the start of Generate.
+func (gen *Generator) Reset() {
+	gen.NameSpaces = make(map[string]*NameSpace)
+	gen.nsChanges = gen.nsChanges[:0]
+	gen.ClearMemoCache()
+	clear(gen.singletons)
+	clear(gen.dependencies)
+	gen.Statistics = Statistics{}
+	gen.nodeCount = 0
+	gen.limits = limitNodes{
+		arrays:  gen.ArrayLimits,
+		strings: gen.StringLimits,
+		uris:    gen.URILimits,
+	}
+}
+
+// chooseLength returns a random length in the range [minlength,
+// maxlength]. If maxlength is less than minlength, the result is
+// minlength. Equal bounds still consume a random number so that a seed
+// keeps producing the same documents.
+func (gen *Generator) chooseLength(minlength, maxlength int) int {
+	if maxlength < minlength {
+		return minlength
 	}
-	return nil, fmt.Errorf("unknown type %q", typename)
+	return minlength + gen.Rand.IntN(maxlength-minlength+1)
 }
 
 func (gen *Generator) randomString(minlength, maxlength int) string {
@@ -204,7 +825,7 @@ func (gen *Generator) randomString(minlength, maxlength int) string {
 		// FIXME: make bound on maximum length configurable
 		maxlength = minlength + 10
 	}
-	length := minlength + gen.Rand.IntN(maxlength-minlength+1)
+	length := gen.chooseLength(minlength, maxlength)
 	var builder strings.Builder
 	for range length {
 		builder.WriteByte(choose(gen.Rand, []byte(chars)))
@@ -223,21 +844,37 @@ func (gen *Generator) randomArray(tmpl *TmplArray, depth int) (any, error) {
 		// FIXME: make bound on maximum length configurable
 		maxitems = minitems + 2
 	}
+	limit := gen.limits.arrays.GetLimit()
+	if limit > 0 && maxitems > limit {
+		maxitems = max(minitems, limit)
+	}
 
+	// Arrays of unique references are generated like a TmplRef with
+	// counts so that the references can be chosen from all IDs
+	// available after the document has been generated. Without a
+	// maximum they may refer to all of them unless the limits say
+	// otherwise.
 	if refnode, ok := gen.Template.Types[tmpl.Items].(*TmplRef); ok {
 		known := gen.numNSValues(refnode.Namespace)
 		if known >= minitems && tmpl.UniqueItems {
-			ref := &reference{
-				namespace: refnode.Namespace,
-				length:    minitems + gen.Rand.IntN(known-minitems+1),
-				values:    nil,
+			maxrefs := tmpl.MaxItems
+			if maxrefs >= 0 || limit > 0 {
+				maxrefs = maxitems
 			}
-			gen.adNSRef(refnode.Namespace, ref)
-			return ref, nil
+			return gen.generateReferences(refnode.Namespace, minitems, maxrefs)
 		}
 	}
 
-	length := minitems + gen.Rand.IntN(maxitems-minitems+1)
+	// Close to the maximum depth large arrays mostly produce
+	// ErrDepthExceeded errors, so make them smaller.
+	if depth < gen.DepthSizeReductionThreshold {
+		maxitems = max(minitems, maxitems*depth/gen.DepthSizeReductionThreshold)
+	}
+
+	length := maxitems
+	if !gen.ForceMaxSize {
+		length = minitems + gen.arrayLength(maxitems-minitems, tmpl.LengthDistribution)
+	}
 	items := make([]any, 0, length)
 	notInItems := func(v any) bool {
 		if !tmpl.UniqueItems {
@@ -247,15 +884,59 @@ func (gen *Generator) randomArray(tmpl *TmplArray, depth int) (any, error) {
 			return reflect.DeepEqual(item, v)
 		})
 	}
-	for range length {
-		item, err := gen.generateItemUntil(tmpl.Items, 10, depth-1, notInItems)
-		switch {
-		case errors.Is(err, ErrNoValidValue):
-			continue
-		case err != nil:
+	if tmpl.GroupBy != "" {
+		grouped, err := gen.groupedArrayItems(tmpl, length, depth-2)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, grouped...)
+	} else {
+		for range length {
+			if gen.ProgressFunc != nil {
+				gen.ProgressFunc(ProgressEvent{
+					Phase:    "array_item",
+					TypeName: tmpl.Items,
+					Depth:    gen.MaxDepth - depth,
+					Count:    len(items),
+				})
+			}
+			item, err := gen.generateItemUntil(tmpl.Items, gen.MaxItemAttempts, depth-1, notInItems)
+			switch {
+			case errors.Is(err, ErrNoValidValue):
+				continue
+			case err != nil:
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+
+	// If Contains is the same as Items any item matches, but there has
+	// to be at least one.
+	if tmpl.Contains != "" && (tmpl.Contains != tmpl.Items || len(items) == 0) {
+		item, err := gen.generateItemUntil(tmpl.Contains, gen.MaxItemAttempts, depth-1, notInItems)
+		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		if len(items) < maxitems || len(items) == 0 {
+			items = append(items, item)
+		} else {
+			items[gen.Rand.IntN(len(items))] = item
+		}
+	}
+
+	// Pad the array with items of the fallback type if it's too short.
+	if tmpl.PadWithFallback != "" {
+		for len(items) < minitems {
+			item, err := gen.generateItemUntil(tmpl.PadWithFallback, gen.MaxItemAttempts, depth-1, notInItems)
+			if errors.Is(err, ErrNoValidValue) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
 	}
 
 	if len(items) < minitems {
@@ -267,44 +948,214 @@ func (gen *Generator) randomArray(tmpl *TmplArray, depth int) (any, error) {
 	return items, nil
 }
 
+// foldCase changes the letter case of s as described by fold.
+func (gen *Generator) foldCase(s string, fold CaseFold) string {
+	switch fold {
+	case CaseUpper:
+		return strings.ToUpper(s)
+	case CaseLower:
+		return strings.ToLower(s)
+	case CaseTitle:
+		runes := []rune(s)
+		for i, r := range runes {
+			if i == 0 || unicode.IsSpace(runes[i-1]) {
+				runes[i] = unicode.ToTitle(r)
+			}
+		}
+		return string(runes)
+	case CaseRandom:
+		runes := []rune(s)
+		for i, r := range runes {
+			if gen.Rand.IntN(2) == 0 {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+		}
+		return string(runes)
+	default:
+		return s
+	}
+}
+
+// groupedArrayItems generates length items for an array with a GroupBy
+// property. The items are split into a random number of groups. The
+// items of a group share the value of the GroupBy property, which is
+// generated once per group. The items are generated at the given depth.
+func (gen *Generator) groupedArrayItems(
+	tmpl *TmplArray,
+	length, depth int,
+) ([]any, error) {
+	obj, ok := gen.Template.Types[tmpl.Items].(*TmplObject)
+	if !ok {
+		return nil, fmt.Errorf("groupby: items type %q is not an object", tmpl.Items)
+	}
+	idx := slices.IndexFunc(obj.Properties, func(prop *Property) bool {
+		return prop.Name == tmpl.GroupBy
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf(
+			"groupby: items type %q has no property %q", tmpl.Items, tmpl.GroupBy,
+		)
+	}
+	keyType := obj.Properties[idx].Type
+	if length == 0 {
+		return nil, nil
+	}
+
+	numGroups := 1 + gen.Rand.IntN(length)
+	items := make([]any, 0, length)
+	notInItems := func(v any) bool {
+		if !tmpl.UniqueItems {
+			return true
+		}
+		return !slices.ContainsFunc(items, func(item any) bool {
+			return reflect.DeepEqual(item, v)
+		})
+	}
+	for group := range numGroups {
+		key, err := gen.generateNode(keyType, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		size := length / numGroups
+		if group < length%numGroups {
+			size++
+		}
+		for range size {
+			item, err := gen.groupItem(tmpl.Items, tmpl.GroupBy, key, depth, notInItems)
+			switch {
+			case errors.Is(err, ErrNoValidValue):
+				continue
+			case err != nil:
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// groupItem generates an item of the type typename for a grouped array
+// and sets its property keyProp to key. The item is generated without
+// the key property so that no values, and in particular no IDs, are
+// generated for it only to be replaced by the key of the group. Like
+// generateItemUntil it tries up to MaxItemAttempts times to generate an
+// item for which cond returns true.
+func (gen *Generator) groupItem(
+	typename, keyProp string,
+	key any,
+	depth int,
+	cond func(any) bool,
+) (any, error) {
+	for range gen.MaxItemAttempts {
+		snapshot := gen.snapshotNamespaces()
+		gen.omitProperty = keyProp
+		value, err := gen.generateNode(typename, depth)
+		gen.omitProperty = ""
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("groupby: item of type %q is not an object", typename)
+		}
+		// The value may be memoized, so it must not be modified.
+		item := maps.Clone(obj)
+		item[keyProp] = key
+		if cond(item) {
+			return item, nil
+		}
+		gen.restoreSnapshot(snapshot)
+	}
+	return nil, ErrNoValidValue
+}
+
+// withoutProperty returns a copy of the object that doesn't generate the
+// property name, which is added by the caller afterwards.
+func (t *TmplObject) withoutProperty(name string) *TmplObject {
+	filtered := *t
+	filtered.PropertyFilter = append(slices.Clone(t.PropertyFilter), name)
+	idx := slices.IndexFunc(t.Properties, func(prop *Property) bool {
+		return prop.Name == name
+	})
+	required := idx >= 0 && (t.Properties[idx].Required ||
+		slices.Contains(t.RequiredOverrides, name))
+	if required && filtered.MinProperties > 0 {
+		filtered.MinProperties--
+	}
+	// An optional key doesn't count towards MinProperties, but the
+	// remaining properties may not be enough to reach it.
+	remaining := 0
+	for _, prop := range t.Properties {
+		if !filtered.excluded(prop.Name) {
+			remaining++
+		}
+	}
+	filtered.MinProperties = min(filtered.MinProperties, remaining)
+	if filtered.MaxProperties > 0 {
+		filtered.MaxProperties--
+	}
+	return &filtered
+}
+
+// arrayLength returns a random number in the range [0, span] drawn
+// from the given distribution.
+func (gen *Generator) arrayLength(span int, dist LengthDistribution) int {
+	switch dist {
+	case LengthGeometric:
+		// Scale the exponential distribution so that the mean is at a
+		// quarter of the range.
+		return min(int(gen.Rand.ExpFloat64()*float64(span)/4), span)
+	case LengthPoisson:
+		// Knuth's algorithm with the mean in the middle of the range.
+		// The loop is bounded by span because larger values would be
+		// clamped anyway.
+		limit := math.Exp(-float64(span) / 2)
+		k, p := 0, gen.Rand.Float64()
+		for p > limit && k < span {
+			k++
+			p *= gen.Rand.Float64()
+		}
+		return k
+	default:
+		return gen.chooseLength(0, span)
+	}
+}
+
 // generateItemUntil repeatedly tries to generate an item of type
 // typename until an item has been generated for which cond returns
 // true. If no such item could be generated in maxAttempts attempts,
 // ErrNoValidValue is returned as error. There may be other errors if
 // generating an item fails for other reasons.
+//
+// The namespaces are snapshotted before each attempt and restored
+// whenever an item is rejected, so that IDs generated for rejected
+// items do not end up in the namespaces.
 func (gen *Generator) generateItemUntil(
 	typename string,
 	maxAttempts int,
 	depth int,
 	cond func(any) bool,
 ) (any, error) {
-	var (
-		item    any
-		err     error
-		success bool
-	)
-
-generateItem:
 	for range maxAttempts {
-		item, err = gen.generateNode(typename, depth-1)
-		switch {
-		case err != nil:
+		snapshot := gen.snapshotNamespaces()
+		item, err := gen.generateNode(typename, depth-1)
+		if err != nil {
 			return nil, err
-		case !cond(item):
-			continue
-		default:
-			success = true
-			break generateItem
 		}
+		if cond(item) {
+			return item, nil
+		}
+		gen.restoreSnapshot(snapshot)
 	}
-	if !success {
-		return nil, ErrNoValidValue
-	}
-	return item, nil
+	return nil, ErrNoValidValue
 }
 
 func (gen *Generator) randomOneOf(oneof []string, depth int) (any, error) {
-	shuffled := shuffle(gen.Rand, oneof)
+	// The template may be shared with other generators, so it must not
+	// be modified.
+	shuffled := shuffle(gen.Rand, slices.Clone(oneof))
 	var abandoned error
 	for _, typename := range shuffled {
 		value, err := gen.generateNode(typename, depth-1)
@@ -321,26 +1172,168 @@ func (gen *Generator) randomOneOf(oneof []string, depth int) (any, error) {
 	return nil, fmt.Errorf("could not generate any of %v", oneof)
 }
 
+// weightedOneOf generates a value for one of the choices, chosen
+// randomly according to their weights. If the branch of the chosen
+// alternative is abandoned, one of the remaining alternatives is tried.
+func (gen *Generator) weightedOneOf(choices []WeightedChoice, depth int) (any, error) {
+	remaining := slices.Clone(choices)
+	var abandoned error
+	for len(remaining) > 0 {
+		var total float64
+		for _, choice := range remaining {
+			total += choice.Weight
+		}
+		i, r := 0, gen.Rand.Float64()*total
+		for ; i < len(remaining)-1; i++ {
+			if r < remaining[i].Weight {
+				break
+			}
+			r -= remaining[i].Weight
+		}
+		value, err := gen.generateNode(remaining[i].Type, depth-1)
+		if errors.Is(err, ErrBranchAbandoned) {
+			abandoned = err
+			remaining = slices.Delete(remaining, i, i+1)
+			continue
+		}
+		return value, err
+	}
+
+	if abandoned != nil {
+		return nil, abandoned
+	}
+	return nil, errors.New("no choices to generate a value from")
+}
+
+// multiBranchOneOf generates values for up to MaxBranches randomly
+// chosen alternatives of node. If all of them are objects, they are
+// merged into one object. Otherwise the first value is returned.
+func (gen *Generator) multiBranchOneOf(node *TmplOneOf, depth int) (any, error) {
+	var values []any
+	var abandoned error
+	for _, typename := range shuffle(gen.Rand, slices.Clone(node.eligible(depth))) {
+		if len(values) >= node.MaxBranches {
+			break
+		}
+		value, err := gen.generateNode(typename, depth-1)
+		switch {
+		case errors.Is(err, ErrBranchAbandoned):
+			abandoned = err
+			continue
+		case err != nil:
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if len(values) < node.MinBranches {
+		if abandoned != nil {
+			return nil, abandoned
+		}
+		return nil, fmt.Errorf(
+			"could not generate %d of %v", node.MinBranches, node.OneOf,
+		)
+	}
+
+	merged := make(map[string]any)
+	for _, value := range values {
+		properties, ok := value.(map[string]any)
+		if !ok {
+			return values[0], nil
+		}
+		for name, v := range properties {
+			merged[name] = v
+		}
+	}
+	return merged, nil
+}
+
 func (gen *Generator) generateObject(node *TmplObject, depth int) (any, error) {
+	if gen.omitProperty != "" {
+		node = node.withoutProperty(gen.omitProperty)
+		gen.omitProperty = ""
+	}
 	var optional, required []*Property
 	for _, prop := range node.Properties {
 		switch {
-		case prop.Required:
+		case node.excluded(prop.Name):
+			continue
+		case prop.Required, slices.Contains(node.RequiredOverrides, prop.Name):
 			required = append(required, prop)
 		default:
 			optional = append(optional, prop)
 		}
 	}
 
+	numProps := len(required) + len(optional)
+	stub := node.Stub && depth < gen.StubDepthThreshold
 	properties := make(map[string]any)
-	for _, prop := range required {
-		value, err := gen.generateNode(prop.Type, depth-1)
+	var branchAbandoned error
+
+	// Properties with an explicit order come first. Failing to generate
+	// one of the optional ones is not fatal. The optional ones are only
+	// generated if MaxProperties leaves room for them in addition to
+	// the required properties not generated yet.
+	hasRoom := func() bool {
+		return node.MaxProperties < 0 ||
+			len(properties)+len(required) < node.MaxProperties
+	}
+	for _, name := range node.GenerationOrder {
+		isName := func(prop *Property) bool { return prop.Name == name }
+		if i := slices.IndexFunc(required, isName); i >= 0 {
+			prop := required[i]
+			required = slices.Delete(required, i, i+1)
+			value, err := gen.generateProperty(prop, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			properties[prop.Name] = value
+		} else if i := slices.IndexFunc(optional, isName); i >= 0 && !stub && hasRoom() {
+			prop := optional[i]
+			optional = slices.Delete(optional, i, i+1)
+			value, err := gen.generateProperty(prop, depth-1)
+			switch {
+			case errors.Is(err, ErrBranchAbandoned):
+				branchAbandoned = err
+				continue
+			case err != nil:
+				return nil, err
+			}
+			properties[prop.Name] = value
+		}
+	}
+
+	for _, prop := range gen.sortByDependencies(required) {
+		value, err := gen.generateProperty(prop, depth-1)
 		if err != nil {
 			return nil, err
 		}
 		properties[prop.Name] = value
 	}
 
+	// Optional properties become required if the properties generated
+	// so far meet the conditions of their group.
+	for _, group := range node.ConditionalRequired {
+		if !group.applies(properties) {
+			continue
+		}
+		for _, name := range group.ThenRequired {
+			i := slices.IndexFunc(optional, func(prop *Property) bool {
+				return prop.Name == name
+			})
+			if i < 0 {
+				continue
+			}
+			prop := optional[i]
+			optional = slices.Delete(optional, i, i+1)
+			value, err := gen.generateProperty(prop, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			properties[prop.Name] = value
+		}
+	}
+
 	// Choose a value for extraProps, the number of optional properties
 	// to add based on how many we need at least, node.MinProperties,
 	// and how many we may have at most, node.MaxProperties. Both of
@@ -356,24 +1349,46 @@ func (gen *Generator) generateObject(node *TmplObject, depth int) (any, error) {
 	minProps := max(node.MinProperties, len(properties))
 	maxProps := node.MaxProperties
 	if maxProps < 0 {
-		maxProps = len(node.Properties)
+		maxProps = numProps
+		if gen.SizeFactorObjects && gen.SizeFactor < 1.0 {
+			maxProps = max(minProps, int(float64(numProps)*gen.SizeFactor)+1)
+		}
 	}
 	extraProps := minProps - len(properties)
-	if maxProps > minProps {
-		extraProps += gen.Rand.IntN(maxProps - minProps + 1)
+	skipProbability := node.SkipProbability
+	useOptionalProbability := skipProbability == 0 && gen.OptionalProbability > 0
+	switch {
+	case maxProps <= minProps || stub:
+	case gen.ForceMaxSize:
+		extraProps = maxProps - len(properties)
+		skipProbability = 0
+	case useOptionalProbability:
+		// The skipped properties decide which optional properties are
+		// generated, so all others are.
+		extraProps = maxProps - len(properties)
+		skipProbability = 1 - gen.OptionalProbability
+	default:
+		extraProps = gen.chooseLength(minProps, maxProps) - len(properties)
 	}
 
 	// generate more properties until we've either generated extraProps
 	// additional properties or we run out of optional properties to
 	// try. Generating a property may fail because the maximum depth
-	// would be exceeded in which case we just try again with a
-	// different property.
-	var branchAbandoned error
-	for extraProps > 0 && len(optional) > 0 {
-		i := gen.Rand.IntN(len(optional))
-		prop := optional[i]
-		optional = slices.Delete(optional, i, i+1)
-		value, err := gen.generateNode(prop.Type, depth-1)
+	// would be exceeded in which case we retry once and then try again
+	// with a different property. Property groups are handled as a
+	// unit that is skipped if it would exceed maxProps.
+	units := groupProperties(optional, node.PropertyGroups)
+	if skipProbability > 0 {
+		units = gen.skipUnits(units, skipProbability, minProps-len(properties))
+	}
+	for extraProps > 0 && len(units) > 0 {
+		i := gen.Rand.IntN(len(units))
+		unit := units[i]
+		units = slices.Delete(units, i, i+1)
+		if len(unit) > 1 && len(properties)+len(unit) > maxProps {
+			continue
+		}
+		values, err := gen.generateOptionalProperties(unit, depth)
 		switch {
 		case errors.Is(err, ErrBranchAbandoned):
 			branchAbandoned = err
@@ -381,8 +1396,14 @@ func (gen *Generator) generateObject(node *TmplObject, depth int) (any, error) {
 		case err != nil:
 			return nil, err
 		}
-		properties[prop.Name] = value
-		extraProps--
+		maps.Copy(properties, values)
+		extraProps -= len(unit)
+	}
+
+	if node.AdditionalProperties != "" && !stub {
+		if err := gen.generateAdditionalProperties(node, properties, depth); err != nil {
+			return nil, err
+		}
 	}
 
 	// If we failed to generate at least minProps properties, we've
@@ -399,6 +1420,222 @@ func (gen *Generator) generateObject(node *TmplObject, depth int) (any, error) {
 	return properties, nil
 }
 
+// generateProperty generates a value for the property prop of an
+// object. The limits of the property apply while the value is
+// generated.
+func (gen *Generator) generateProperty(prop *Property, depth int) (any, error) {
+	limits := gen.limits
+	gen.limits = limits.descend(prop.Name)
+	defer func() { gen.limits = limits }()
+	return gen.generateNode(prop.Type, depth)
+}
+
+// generateAdditionalProperties adds up to node.MaxAdditional properties
+// with random names to properties, without exceeding MaxProperties.
+func (gen *Generator) generateAdditionalProperties(
+	node *TmplObject,
+	properties map[string]any,
+	depth int,
+) error {
+	count := node.MaxAdditional
+	if node.MaxProperties >= 0 {
+		count = min(count, node.MaxProperties-len(properties))
+	}
+	if count <= 0 {
+		return nil
+	}
+	for range gen.Rand.IntN(count + 1) {
+		name := gen.randomString(3, 15)
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		value, err := gen.generateProperty(&Property{
+			Name: name,
+			Type: node.AdditionalProperties,
+		}, depth-1)
+		switch {
+		case errors.Is(err, ErrBranchAbandoned):
+			continue
+		case err != nil:
+			return err
+		}
+		properties[name] = value
+	}
+	return nil
+}
+
+// typeDependencies returns the dependencies of a type, computing them
+// only once per document.
+func (gen *Generator) typeDependencies(typename string) Dependencies {
+	deps, ok := gen.dependencies[typename]
+	if !ok {
+		if gen.dependencies == nil {
+			gen.dependencies = make(map[string]Dependencies)
+		}
+		deps = gen.Template.Dependencies(typename)
+		gen.dependencies[typename] = deps
+	}
+	return deps
+}
+
+// sortByDependencies returns the properties sorted so that properties
+// whose types generate IDs of a namespace come before the properties
+// whose types reference IDs of that namespace. Apart from that the
+// order is kept. Cyclic dependencies are broken arbitrarily.
+func (gen *Generator) sortByDependencies(props []*Property) []*Property {
+	if len(props) < 2 {
+		return props
+	}
+	deps := make([]Dependencies, len(props))
+	for i, prop := range props {
+		deps[i] = gen.typeDependencies(prop.Type)
+	}
+	dependsOn := func(i, j int) bool {
+		return slices.ContainsFunc(deps[i].References, func(ns string) bool {
+			return slices.Contains(deps[j].Defines, ns)
+		})
+	}
+
+	sorted := make([]*Property, 0, len(props))
+	visited := make([]bool, len(props))
+	var visit func(int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for j := range props {
+			if j != i && dependsOn(i, j) {
+				visit(j)
+			}
+		}
+		sorted = append(sorted, props[i])
+	}
+	for i := range props {
+		visit(i)
+	}
+	return sorted
+}
+
+// groupProperties splits the optional properties into the units in
+// which they are selected. Each group becomes one unit containing the
+// group's properties that are in optional. All other properties are
+// units of their own.
+func groupProperties(optional []*Property, groups [][]string) [][]*Property {
+	units := make([][]*Property, 0, len(optional))
+	grouped := make(map[string]bool)
+	for _, group := range groups {
+		var unit []*Property
+		for _, prop := range optional {
+			if slices.Contains(group, prop.Name) {
+				unit = append(unit, prop)
+				grouped[prop.Name] = true
+			}
+		}
+		if len(unit) > 0 {
+			units = append(units, unit)
+		}
+	}
+	for _, prop := range optional {
+		if !grouped[prop.Name] {
+			units = append(units, []*Property{prop})
+		}
+	}
+	return units
+}
+
+// skipUnits randomly removes units of optional properties, each with
+// the given probability. Units are only removed as long as the
+// remaining units have at least needed properties.
+func (gen *Generator) skipUnits(
+	units [][]*Property,
+	probability float64,
+	needed int,
+) [][]*Property {
+	var available int
+	for _, unit := range units {
+		available += len(unit)
+	}
+	kept := make([][]*Property, 0, len(units))
+	for _, unit := range units {
+		if available-len(unit) >= needed && gen.Rand.Float64() < probability {
+			available -= len(unit)
+			continue
+		}
+		kept = append(kept, unit)
+	}
+	return kept
+}
+
+// generateOptionalProperties generates values for all of the given
+// properties. If one of them cannot be generated, none of them are and
+// IDs generated for the others are discarded.
+func (gen *Generator) generateOptionalProperties(
+	props []*Property,
+	depth int,
+) (_ map[string]any, err error) {
+	if len(props) > 1 {
+		snapshot := gen.snapshotNamespaces()
+		defer func() {
+			if errors.Is(err, ErrBranchAbandoned) {
+				gen.restoreSnapshot(snapshot)
+			}
+		}()
+	}
+	values := make(map[string]any, len(props))
+	for _, prop := range props {
+		value, err := gen.generateProperty(prop, depth-1)
+		if errors.Is(err, ErrDepthExceeded) && depth > 3 {
+			// Try once more with a smaller depth budget, which makes
+			// the descendants that adapt to the remaining depth, e.g.
+			// stub objects, generate smaller values.
+			value, err = gen.generateProperty(prop, depth-2)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[prop.Name] = value
+	}
+	return values, nil
+}
+
+func (gen *Generator) generateConditional(
+	node *TmplConditional,
+	depth int,
+) (any, error) {
+	value, err := gen.generateNode(node.Condition, depth-1)
+	if err != nil {
+		return nil, err
+	}
+	properties, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf(
+			"condition type %q did not generate an object", node.Condition,
+		)
+	}
+
+	branch := node.Else
+	if gen.Rand.Float64() < node.CondProbability {
+		branch = node.Then
+	}
+	for _, typename := range branch {
+		value, err := gen.generateNode(typename, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		extra, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf(
+				"conditional type %q did not generate an object", typename,
+			)
+		}
+		for name, v := range extra {
+			properties[name] = v
+		}
+	}
+	return properties, nil
+}
+
 func (gen *Generator) randomNumber(minimum, maximum *float32) float32 {
 	low := float64(-math.MaxFloat32)
 	high := float64(math.MaxFloat32)
@@ -412,6 +1649,35 @@ func (gen *Generator) randomNumber(minimum, maximum *float32) float32 {
 	return float32(low + gen.Rand.Float64()*(high-low))
 }
 
+// randomInteger returns a random integer between minimum and maximum,
+// inclusively. Missing bounds are chosen so that the range covers 2000
+// integers, which is -1000..1000 if both are missing.
+func (gen *Generator) randomInteger(minimum, maximum *int64) int64 {
+	const span = 2000
+	var low, high int64
+	switch {
+	case minimum == nil && maximum == nil:
+		low, high = -span/2, span/2
+	case minimum == nil:
+		high = *maximum
+		low = max(high, math.MinInt64+span) - span
+	case maximum == nil:
+		low = *minimum
+		high = min(low, math.MaxInt64-span) + span
+	default:
+		low, high = *minimum, *maximum
+	}
+	if high <= low {
+		return low
+	}
+	n := uint64(high-low) + 1
+	if n == 0 {
+		// the range covers all int64 values
+		return int64(gen.Rand.Uint64())
+	}
+	return low + int64(gen.Rand.Uint64N(n))
+}
+
 func (gen *Generator) randomDateTime(mindate, maxdate *time.Time) time.Time {
 	if mindate == nil {
 		if maxdate == nil {
@@ -430,7 +1696,20 @@ func (gen *Generator) randomDateTime(mindate, maxdate *time.Time) time.Time {
 	return mindate.Add(time.Duration(gen.Rand.Float64() * float64(duration)))
 }
 
-func (gen *Generator) loremIpsum(minlength, maxlength int, unit LoremUnit) string {
+// loremStructure describes the number of words per sentence and
+// sentences per paragraph of lorem ipsum text. Zero values mean that
+// defaults are used.
+type loremStructure struct {
+	minWords, maxWords         int
+	minSentences, maxSentences int
+}
+
+func (gen *Generator) loremIpsum(
+	minlength, maxlength int,
+	unit LoremUnit,
+	structure *loremStructure,
+	locale *loremLocale,
+) string {
 	if minlength < 0 {
 		minlength = 0
 	}
@@ -439,9 +1718,21 @@ func (gen *Generator) loremIpsum(minlength, maxlength int, unit LoremUnit) strin
 		maxlength = minlength + 10
 	}
 
-	length := minlength + gen.Rand.IntN(maxlength-minlength)
+	length := gen.chooseLength(minlength, maxlength)
+
+	if locale != nil {
+		if structure == nil {
+			structure = &loremStructure{}
+		}
+		word := func() string { return choose(gen.Rand, locale.words) }
+		return gen.structuredLoremIpsum(word, length, unit, structure, locale)
+	}
 
 	lorem := loremipsum.NewWithSeed(gen.Rand.Int64())
+	if structure != nil && unit != LoremWords {
+		latin := &loremLocale{separator: " ", fullStop: "."}
+		return gen.structuredLoremIpsum(lorem.Word, length, unit, structure, latin)
+	}
 	switch unit {
 	case LoremSentences:
 		return lorem.Sentences(length)
@@ -452,7 +1743,68 @@ func (gen *Generator) loremIpsum(minlength, maxlength int, unit LoremUnit) strin
 	}
 }
 
-func (gen *Generator) book(minlength, maxlength int, path string) (string, error) {
+// structuredLoremIpsum builds text of length words, sentences or
+// paragraphs from individual words returned by word so that the
+// sentences and paragraphs have the lengths given by structure. The
+// separator and full stop are taken from locale, its words are not
+// used.
+func (gen *Generator) structuredLoremIpsum(
+	word func() string,
+	length int,
+	unit LoremUnit,
+	structure *loremStructure,
+	locale *loremLocale,
+) string {
+	between := func(low, high, defaultHigh int) int {
+		low = max(low, 1)
+		if high <= 0 {
+			high = max(low, defaultHigh)
+		}
+		return low + gen.Rand.IntN(high-low+1)
+	}
+	words := func(count int) []string {
+		list := make([]string, count)
+		for i := range list {
+			list[i] = word()
+		}
+		return list
+	}
+	sentence := func() string {
+		list := words(between(structure.minWords, structure.maxWords, 20))
+		first := []rune(list[0])
+		list[0] = strings.ToUpper(string(first[0])) + string(first[1:])
+		return strings.Join(list, locale.separator) + locale.fullStop
+	}
+	sentences := func(count int) string {
+		list := make([]string, count)
+		for i := range list {
+			list[i] = sentence()
+		}
+		return strings.Join(list, locale.separator)
+	}
+
+	switch unit {
+	case LoremSentences:
+		return sentences(length)
+	case LoremParagraphs:
+		// handled below
+	default:
+		return strings.Join(words(length), locale.separator)
+	}
+	paragraphs := make([]string, length)
+	for i := range paragraphs {
+		paragraphs[i] = sentences(
+			between(structure.minSentences, structure.maxSentences, 8),
+		)
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+func (gen *Generator) book(
+	minlength, maxlength int,
+	path string,
+	sentenceBoundary bool,
+) (string, error) {
 	if minlength < 0 {
 		minlength = 0
 	}
@@ -461,7 +1813,7 @@ func (gen *Generator) book(minlength, maxlength int, path string) (string, error
 		maxlength = minlength + 10
 	}
 
-	length := minlength + gen.Rand.IntN(maxlength-minlength)
+	length := gen.chooseLength(minlength, maxlength)
 	content, ok := gen.FileCache[path]
 	if !ok {
 		file, err := os.Open(path)
@@ -485,12 +1837,48 @@ func (gen *Generator) book(minlength, maxlength int, path string) (string, error
 	if len(trimmed) < length {
 		length = len(trimmed)
 	}
+	if sentenceBoundary {
+		length = nearestSentenceBoundary(
+			trimmed, length, minlength, min(maxlength, len(trimmed)),
+		)
+	}
 	trimmed = trimmed[:length]
 	return string(trimmed), nil
 }
 
-func (gen *Generator) generateID(namespace string) string {
-	id := gen.randomString(1, 20)
+// nearestSentenceBoundary returns the sentence boundary in text within
+// [minlength, maxlength] that is closest to length. A sentence boundary
+// is the position after a '.', '!' or '?' that is followed by
+// whitespace or the end of the text. If there's no such boundary,
+// length is returned.
+func nearestSentenceBoundary(text []rune, length, minlength, maxlength int) int {
+	isBoundary := func(pos int) bool {
+		if pos <= 0 || pos > len(text) || !strings.ContainsRune(".!?", text[pos-1]) {
+			return false
+		}
+		return pos == len(text) || unicode.IsSpace(text[pos])
+	}
+	for dist := 0; length-dist >= minlength || length+dist <= maxlength; dist++ {
+		if length-dist >= minlength && isBoundary(length-dist) {
+			return length - dist
+		}
+		if length+dist <= maxlength && isBoundary(length+dist) {
+			return length + dist
+		}
+	}
+	return length
+}
+
+// generateID generates an ID and adds it to the namespace. Lengths of 0
+// or less select the default range of 1 to 20 characters.
+func (gen *Generator) generateID(namespace string, minlength, maxlength int) string {
+	if minlength < 1 {
+		minlength = 1
+	}
+	if maxlength <= 0 {
+		maxlength = max(minlength, 20)
+	}
+	id := gen.randomString(minlength, maxlength)
 	gen.addNSValue(namespace, id)
 	return id
 }
@@ -511,8 +1899,39 @@ func (gen *Generator) generateReference(namespace string) (any, error) {
 	return ref, nil
 }
 
+// generateReferences generates a reference to between minCount and
+// maxCount different IDs of the namespace. If maxCount is negative,
+// the number of IDs is only limited by the number of IDs currently
+// available in the namespace.
+func (gen *Generator) generateReferences(
+	namespace string,
+	minCount, maxCount int,
+) (any, error) {
+	known := gen.numNSValues(namespace)
+	if known < minCount {
+		return nil, fmt.Errorf(
+			"%w: fewer than %d IDs in namespace %q",
+			ErrBranchAbandoned, minCount, namespace,
+		)
+	}
+	if maxCount < 0 || maxCount > known {
+		maxCount = known
+	}
+
+	ref := &reference{
+		namespace: namespace,
+		length:    minCount + gen.Rand.IntN(maxCount-minCount+1),
+		values:    nil,
+	}
+	gen.adNSRef(namespace, ref)
+	return ref, nil
+}
+
 func (gen *Generator) fixupReferences() error {
-	for name, ns := range gen.NameSpaces {
+	// Iterate in a fixed order so that the same seed always leads to
+	// the same references.
+	for _, name := range gen.NamespaceNames() {
+		ns := gen.NameSpaces[name]
 		if len(ns.Values) == 0 && len(ns.Refs) > 0 {
 			// this should never happen because references should
 			// only be generated if there are values available
@@ -521,12 +1940,19 @@ func (gen *Generator) fixupReferences() error {
 				name,
 			)
 		}
+		if gen.ProgressFunc != nil {
+			gen.ProgressFunc(ProgressEvent{
+				Phase:    "fixup",
+				TypeName: name,
+				Count:    len(ns.Refs),
+			})
+		}
 		for _, ref := range ns.Refs {
 			switch {
 			case ref.length < 0:
 				ref.values = []string{choose(gen.Rand, ns.Values)}
 			case ref.length == 0:
-				ref.values = nil
+				ref.values = []string{}
 			default:
 				ref.values = chooseK(gen.Rand, ref.length, ns.Values)
 			}
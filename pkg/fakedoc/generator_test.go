@@ -0,0 +1,1970 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// productTemplate returns a template for a document with a list of
+// product IDs and a reference to one of them.
+func productTemplate() *Template {
+	return &Template{
+		Root: "doc",
+		Types: map[string]TmplNode{
+			"doc": &TmplObject{
+				Properties: []*Property{
+					{Name: "products", Type: "products", Required: true},
+					{Name: "fixed", Type: "product_ref", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"products": &TmplArray{
+				Items:    "product_id",
+				MinItems: 3,
+				MaxItems: 3,
+			},
+			"product_id": &TmplID{Namespace: "product"},
+			"product_ref": &TmplRef{
+				Namespace: "product",
+			},
+		},
+	}
+}
+
+func TestNamespaceInspection(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(productTemplate(), WithRand(rng))
+	doc, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if names := gen.NamespaceNames(); !slices.Equal(names, []string{"product"}) {
+		t.Errorf("NamespaceNames() = %v, expected [product]", names)
+	}
+	values := gen.GetNamespaceValues("product")
+	if len(values) != 3 {
+		t.Errorf("got %d product IDs, expected 3", len(values))
+	}
+	if count := gen.GetNamespaceRefCount("product"); count != 1 {
+		t.Errorf("got %d product references, expected 1", count)
+	}
+	if values := gen.GetNamespaceValues("unknown"); values != nil {
+		t.Errorf("got IDs %v for unknown namespace", values)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Fixed string `json:"fixed"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(values, decoded.Fixed) {
+		t.Errorf("reference %q is not one of the IDs %v", decoded.Fixed, values)
+	}
+}
+
+func TestIDLength(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id       *TmplID
+		min, max int
+	}{
+		{&TmplID{Namespace: "ns"}, 1, 20},
+		{&TmplID{Namespace: "ns", MinLength: -1, MaxLength: -1}, 1, 20},
+		{&TmplID{Namespace: "ns", MinLength: 5, MaxLength: 8}, 5, 8},
+		{&TmplID{Namespace: "ns", MinLength: 25}, 25, 25},
+	} {
+		gen := NewGenerator(&Template{
+			Root:  "id",
+			Types: map[string]TmplNode{"id": tc.id},
+		}, WithRand(rng))
+		longest := 0
+		for range 100 {
+			id := MustGenerate(gen).(string)
+			if len(id) < tc.min || len(id) > tc.max {
+				t.Fatalf("%+v: ID %q not in length range %d..%d",
+					tc.id, id, tc.min, tc.max)
+			}
+			longest = max(longest, len(id))
+		}
+		if longest != tc.max {
+			t.Errorf("%+v: longest ID has length %d, expected %d",
+				tc.id, longest, tc.max)
+		}
+	}
+}
+
+func TestMultipleReferences(t *testing.T) {
+	templ := productTemplate()
+	templ.Types["product_refs"] = &TmplRef{
+		Namespace: "product",
+		Multiple:  true,
+		MinCount:  1,
+		MaxCount:  2,
+	}
+	templ.Types["doc"].(*TmplObject).Properties = append(
+		templ.Types["doc"].(*TmplObject).Properties,
+		&Property{Name: "refs", Type: "product_refs", Required: true},
+	)
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		var doc struct {
+			Fixed string   `json:"fixed"`
+			Refs  []string `json:"refs"`
+		}
+		if err := json.Unmarshal(MustGenerateJSON(gen, false), &doc); err != nil {
+			t.Fatalf("unexpected document structure: %v", err)
+		}
+		if len(doc.Refs) < 1 || len(doc.Refs) > 2 {
+			t.Fatalf("got %d references, expected 1 or 2", len(doc.Refs))
+		}
+	}
+}
+
+func TestGenerateResetsState(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(productTemplate(), WithRand(rng))
+	for range 2 {
+		if _, err := gen.Generate(); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+	}
+	if values := gen.GetNamespaceValues("product"); len(values) != 3 {
+		t.Errorf("got %d product IDs after second document, expected 3",
+			len(values))
+	}
+}
+
+func TestMultiBranchOneOf(t *testing.T) {
+	templ, err := ParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "oneof"
+oneof = ["a", "b"]
+minbranches = 2
+maxbranches = 2
+
+[types.a]
+type = "object"
+[[types.a.properties]]
+name = "a"
+type = "value"
+required = true
+
+[types.b]
+type = "object"
+[[types.b.properties]]
+name = "b"
+type = "value"
+required = true
+
+[types.value]
+type = "string"
+enum = ["x"]
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewGenerator(templ, WithRand(rng)).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	expected := map[string]any{"a": "x", "b": "x"}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("got %v, expected %v", doc, expected)
+	}
+}
+
+func TestGeneratorPool(t *testing.T) {
+	pool := NewGeneratorPool(2, productTemplate(), nil)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gen := pool.Acquire()
+			defer pool.Release(gen)
+			if _, err := gen.Generate(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Generate failed: %v", err)
+	}
+
+	pool = NewGeneratorPool(1, chainTemplate(5), nil, WithMaxDepth(5), WithSizeFactor(0.5))
+	gen := pool.Acquire()
+	if gen.MaxDepth != 5 || gen.SizeFactor != 0.5 {
+		t.Errorf("options not applied: %+v", gen)
+	}
+	if _, err := gen.Generate(); !errors.Is(err, ErrDepthExceeded) {
+		t.Errorf("got error %v, want ErrDepthExceeded", err)
+	}
+	pool.Release(gen)
+}
+
+func TestOneOfKeepsTemplate(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "choice"
+
+[types.choice]
+type = "oneof"
+oneof = ["a", "b", "c", "d"]
+maxbranches = 2
+
+[types.a]
+type = "string"
+enum = ["a"]
+
+[types.b]
+type = "string"
+enum = ["b"]
+
+[types.c]
+type = "string"
+enum = ["c"]
+
+[types.d]
+type = "string"
+enum = ["d"]
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for _, maxBranches := range []int{1, 2} {
+		templ.Types["choice"].(*TmplOneOf).MaxBranches = maxBranches
+		for range 20 {
+			MustGenerate(gen)
+		}
+		if oneof := templ.Types["choice"].(*TmplOneOf).OneOf; !slices.Equal(oneof, []string{"a", "b", "c", "d"}) {
+			t.Errorf("maxbranches %d: alternatives changed to %v", maxBranches, oneof)
+		}
+	}
+}
+
+func BenchmarkGenerateObject(b *testing.B) {
+	obj := &TmplObject{MinProperties: -1, MaxProperties: 3}
+	for i := range 10 {
+		obj.Properties = append(obj.Properties, &Property{
+			Name:     fmt.Sprintf("p%d", i),
+			Type:     "value",
+			Required: i < 2,
+		})
+	}
+	templ := &Template{
+		Root: "obj",
+		Types: map[string]TmplNode{
+			"obj":   obj,
+			"value": &TmplString{MinLength: 1, MaxLength: 5},
+		},
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := gen.generateObject(obj, 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRestoreSnapshotMemoCache(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "pair"
+
+[memoize]
+types = ["product"]
+
+[types.pair]
+type = "array"
+items = "product"
+minitems = 2
+maxitems = 2
+
+[types.product]
+type = "id"
+namespace = "product"
+`)
+	gen := NewGenerator(templ)
+	snapshot := gen.snapshotNamespaces()
+	first, err := gen.generateNode("product", 5)
+	if err != nil {
+		t.Fatalf("generateNode failed: %v", err)
+	}
+	gen.restoreSnapshot(snapshot)
+	if _, ok := gen.memoCache["product"]; ok {
+		t.Error("memoized value of abandoned branch was kept")
+	}
+	second, err := gen.generateNode("product", 5)
+	if err != nil {
+		t.Fatalf("generateNode failed: %v", err)
+	}
+	if ids := gen.GetNamespaceValues("product"); !slices.Equal(ids, []string{second.(string)}) {
+		t.Errorf("namespace has IDs %v, expected only %v (first was %v)", ids, second, first)
+	}
+
+	doc := MustGenerate(gen).([]any)
+	if doc[0] != doc[1] {
+		t.Errorf("memoized values differ: %v", doc)
+	}
+}
+
+func TestGenerateItemUntilDiscardsRejected(t *testing.T) {
+	templ := MustParseTemplate(`
+[types.product]
+type = "id"
+namespace = "product"
+`)
+	gen := NewGenerator(templ)
+	attempts := 0
+	item, err := gen.generateItemUntil("product", 10, 5, func(any) bool {
+		attempts++
+		return attempts == 4
+	})
+	if err != nil {
+		t.Fatalf("generateItemUntil failed: %v", err)
+	}
+	if ids := gen.GetNamespaceValues("product"); !slices.Equal(ids, []string{item.(string)}) {
+		t.Errorf("namespace has IDs %v, expected only %v", ids, item)
+	}
+
+	_, err = gen.generateItemUntil("product", 3, 5, func(any) bool { return false })
+	if !errors.Is(err, ErrNoValidValue) {
+		t.Errorf("got error %v, expected ErrNoValidValue", err)
+	}
+	if n := len(gen.GetNamespaceValues("product")); n != 1 {
+		t.Errorf("namespace has %d IDs after failed attempts, expected 1", n)
+	}
+}
+
+func TestNilTemplate(t *testing.T) {
+	gen := NewGenerator(nil)
+	if _, err := gen.Generate(); !errors.Is(err, ErrNoTemplate) {
+		t.Errorf("Generate returned %v, expected ErrNoTemplate", err)
+	}
+}
+
+func BenchmarkSnapshotNamespaces(b *testing.B) {
+	gen := NewGenerator(productTemplate())
+	for _, ns := range []string{"product_id", "group_id", "other"} {
+		for i := range 10 {
+			gen.addNSValue(ns, fmt.Sprint(i))
+		}
+	}
+	b.ResetTimer()
+	for range b.N {
+		snapshot := gen.snapshotNamespaces()
+		gen.addNSValue("product_id", "x")
+		gen.restoreSnapshot(snapshot)
+	}
+}
+
+func BenchmarkGenerateCSAF(b *testing.B) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		b.Fatal(err)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := gen.Generate(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRandomInteger(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(productTemplate(), WithRand(rng))
+	ptr := func(n int64) *int64 { return &n }
+	for _, tc := range []struct {
+		minimum, maximum *int64
+		low, high        int64
+	}{
+		{nil, nil, -1000, 1000},
+		{ptr(5), ptr(7), 5, 7},
+		{ptr(3), ptr(3), 3, 3},
+		{ptr(10), nil, 10, 2010},
+		{nil, ptr(-10), -2010, -10},
+		{ptr(math.MaxInt64 - 1), nil, math.MaxInt64 - 2000, math.MaxInt64},
+	} {
+		for range 50 {
+			n := gen.randomInteger(tc.minimum, tc.maximum)
+			if n < tc.low || n > tc.high {
+				t.Fatalf("%d not in range %d..%d", n, tc.low, tc.high)
+			}
+		}
+	}
+
+	templ := MustParseTemplate(`
+root = "count"
+
+[types.count]
+type = "integer"
+minimum = 10000000
+maximum = 10000000
+`)
+	data := MustGenerateJSON(NewGenerator(templ, WithRand(rng)), false)
+	if string(data) != "10000000" {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
+
+func TestGenerationOrder(t *testing.T) {
+	templ, err := ParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+generationorder = ["products"]
+
+[[types.doc.properties]]
+name = "fixed"
+type = "product_ref"
+required = true
+
+[[types.doc.properties]]
+name = "products"
+type = "products"
+
+[types.products]
+type = "array"
+items = "product_id"
+minitems = 1
+maxitems = 2
+
+[types.product_id]
+type = "id"
+namespace = "product"
+
+[types.product_ref]
+type = "ref"
+namespace = "product"
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewGenerator(templ, WithRand(rng)).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	obj := doc.(map[string]any)
+	if _, ok := obj["products"]; !ok {
+		t.Errorf("optional property in generation order is missing: %v", obj)
+	}
+
+	// The ordered optional property must not exceed maxproperties.
+	limited := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+generationorder = ["optional"]
+maxproperties = 1
+
+[[types.doc.properties]]
+name = "required"
+type = "value"
+required = true
+
+[[types.doc.properties]]
+name = "optional"
+type = "value"
+
+[types.value]
+type = "const"
+value = "x"
+`)
+	gen := NewGenerator(limited, WithRand(rng))
+	for range 10 {
+		obj := MustGenerate(gen).(map[string]any)
+		if _, ok := obj["optional"]; ok || len(obj) != 1 {
+			t.Errorf("expected only the required property: %v", obj)
+		}
+	}
+}
+
+func TestPropertyGroups(t *testing.T) {
+	templ, err := ParseTemplate(`
+root = "tlp"
+
+[types.tlp]
+type = "object"
+
+[[types.tlp.properties]]
+name = "label"
+type = "value"
+
+[[types.tlp.properties]]
+name = "url"
+type = "value"
+
+[[types.tlp.properties]]
+name = "other"
+type = "value"
+
+[[types.tlp.propertygroups]]
+properties = ["label", "url"]
+
+[types.value]
+type = "string"
+enum = ["x"]
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	groups := templ.Types["tlp"].(*TmplObject).PropertyGroups
+	if !reflect.DeepEqual(groups, [][]string{{"label", "url"}}) {
+		t.Fatalf("unexpected property groups %v", groups)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		obj := doc.(map[string]any)
+		_, hasLabel := obj["label"]
+		_, hasURL := obj["url"]
+		if hasLabel != hasURL {
+			t.Errorf("grouped properties not generated together: %v", obj)
+		}
+	}
+}
+
+func TestSkipProbability(t *testing.T) {
+	const data = `
+root = "doc"
+
+[types.doc]
+type = "object"
+minproperties = 1
+maxproperties = 3
+skipprobability = 1.0
+
+[[types.doc.properties]]
+name = "a"
+type = "value"
+
+[[types.doc.properties]]
+name = "b"
+type = "value"
+
+[[types.doc.properties]]
+name = "c"
+type = "value"
+
+[types.value]
+type = "string"
+enum = ["x"]
+`
+	templ, err := ParseTemplate(data)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if n := len(doc.(map[string]any)); n != 1 {
+			t.Errorf("generated %d properties, expected exactly 1", n)
+		}
+	}
+
+	bad := strings.Replace(data, "skipprobability = 1.0", "skipprobability = 1.5", 1)
+	if _, err := ParseTemplate(bad); err == nil {
+		t.Error("ParseTemplate accepted skipprobability > 1")
+	}
+}
+
+func TestRequiredPropertyDependencies(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "a_ref"
+type = "ref"
+required = true
+
+[[types.doc.properties]]
+name = "b_products"
+type = "products"
+required = true
+
+[types.ref]
+type = "ref"
+namespace = "product"
+
+[types.products]
+type = "array"
+items = "id"
+minitems = 1
+maxitems = 3
+
+[types.id]
+type = "id"
+namespace = "product"
+`)
+	deps := templ.Dependencies("doc")
+	if !slices.Equal(deps.Defines, []string{"product"}) ||
+		!slices.Equal(deps.References, []string{"product"}) {
+		t.Errorf("unexpected dependencies %+v", deps)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		// Generating the reference fails if there are no IDs yet.
+		var doc struct {
+			Ref      string   `json:"a_ref"`
+			Products []string `json:"b_products"`
+		}
+		if err := json.Unmarshal(MustGenerateJSON(gen, false), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(doc.Products, doc.Ref) {
+			t.Errorf("reference %q not one of the IDs %v", doc.Ref, doc.Products)
+		}
+	}
+}
+
+func TestGenerateDeterminism(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generate := func(seed string) []byte {
+		rng, err := ParseSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := NewGenerator(templ, WithRand(rng)).Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	for i := range 5 {
+		seed := fmt.Sprintf("pcg:%d:2", i+1)
+		if first, second := generate(seed), generate(seed); !bytes.Equal(first, second) {
+			t.Fatalf("documents generated with seed %s differ", seed)
+		}
+	}
+}
+
+func TestBookSentenceBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.txt")
+	text := "Call me Ishmael. Some years ago, never mind how long precisely! " +
+		"Having little or no money in my purse? I thought I would sail about."
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templ := &Template{
+		Root: "text",
+		Types: map[string]TmplNode{
+			"text": &TmplBook{
+				MinLength:        10,
+				MaxLength:        len(text),
+				Path:             path,
+				SentenceBoundary: true,
+			},
+		},
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		s := doc.(string)
+		if !strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "!") &&
+			!strings.HasSuffix(s, "?") {
+			t.Errorf("text %q does not end at a sentence boundary", s)
+		}
+	}
+}
+
+func TestBookPaths(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(strings.Repeat(name[:1], 20)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	templ := &Template{
+		Root: "text",
+		Types: map[string]TmplNode{
+			"text": &TmplBook{MinLength: 5, MaxLength: 10, Paths: paths},
+		},
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	seen := make(map[string]bool)
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		seen[doc.(string)[:1]] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("not all files used: %v", seen)
+	}
+
+	_, err = ParseTemplate(`
+[types.text]
+type = "book"
+path = "a.txt"
+paths = ["b.txt"]
+`)
+	if err == nil {
+		t.Error("ParseTemplate accepted both path and paths")
+	}
+}
+
+func TestLoremLocale(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(&Template{}, WithRand(rng))
+
+	de, err := lookupLoremLocale("de-DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := &TmplLorem{
+		MinLength: 5, MaxLength: 10, Unit: LoremWords, Locale: "de-DE",
+	}
+	value, err := words.Instantiate(gen, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range strings.Fields(value.(string)) {
+		if !slices.Contains(de.words, word) {
+			t.Errorf("%q is not in the German vocabulary", word)
+		}
+	}
+
+	sentences := &TmplLorem{
+		MinLength: 2, MaxLength: 4, Unit: LoremSentences, Locale: "ja",
+	}
+	value, err = sentences.Instantiate(gen, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := value.(string)
+	if strings.Contains(text, " ") || !strings.HasSuffix(text, "。") {
+		t.Errorf("unexpected Japanese text %q", text)
+	}
+
+	if _, err := lookupLoremLocale("xx"); err == nil {
+		t.Error("unsupported locale was accepted")
+	}
+}
+
+func TestArrayContainsItems(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "list"
+
+[types.list]
+type = "array"
+items = "item"
+contains = "item"
+minitems = 0
+maxitems = 2
+
+[types.item]
+type = "const"
+value = "x"
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		if items := MustGenerate(gen).([]any); len(items) == 0 || len(items) > 2 {
+			t.Errorf("array has %d items, expected 1 to 2", len(items))
+		}
+	}
+}
+
+func TestArrayGroupBy(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "list"
+
+[types.list]
+type = "array"
+items = "item"
+minitems = 4
+maxitems = 8
+groupby = "key"
+
+[types.item]
+type = "object"
+
+[[types.item.properties]]
+name = "key"
+type = "key"
+required = true
+
+[[types.item.properties]]
+name = "text"
+type = "text"
+required = true
+
+[types.key]
+type = "id"
+namespace = "key"
+
+[types.text]
+type = "string"
+enum = ["a", "b"]
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 10 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		items := doc.([]any)
+		if len(items) < 4 || len(items) > 8 {
+			t.Errorf("array has %d items, expected 4 to 8", len(items))
+		}
+		var keys []string
+		for _, item := range items {
+			key := item.(map[string]any)["key"].(string)
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		// IDs are only generated for the keys of the groups
+		ids := gen.GetNamespaceValues("key")
+		slices.Sort(ids)
+		slices.Sort(keys)
+		if !slices.Equal(ids, keys) {
+			t.Errorf("keys %v differ from generated IDs %v", keys, ids)
+		}
+	}
+}
+
+func TestArrayGroupByUniqueSubtypes(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "list"
+
+[types.list]
+type = "array"
+items = "item"
+maxitems = 6
+uniqueitems = true
+groupby = "key"
+
+[types.item]
+type = "object"
+abstractsubtypes = ["concrete"]
+
+[[types.item.properties]]
+name = "key"
+type = "key"
+
+[types.concrete]
+type = "object"
+minproperties = 2
+
+[[types.concrete.properties]]
+name = "key"
+type = "key"
+
+[[types.concrete.properties]]
+name = "text"
+type = "text"
+
+[types.key]
+type = "id"
+namespace = "key"
+
+[types.text]
+type = "const"
+value = "a"
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 10 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		// All items of a group are equal, so only one item per group
+		// is unique.
+		var keys []string
+		for _, item := range doc.([]any) {
+			obj := item.(map[string]any)
+			if len(obj) != 2 {
+				t.Errorf("unexpected item %v", obj)
+			}
+			key := obj["key"].(string)
+			if slices.Contains(keys, key) {
+				t.Errorf("duplicate item %v", obj)
+			}
+			keys = append(keys, key)
+		}
+		// The key property of the subtype isn't generated either
+		ids := gen.GetNamespaceValues("key")
+		slices.Sort(ids)
+		slices.Sort(keys)
+		if !slices.Equal(ids, keys) {
+			t.Errorf("keys %v differ from generated IDs %v", keys, ids)
+		}
+	}
+}
+
+func TestArrayPadWithFallback(t *testing.T) {
+	const data = `
+root = "list"
+
+[types.list]
+type = "array"
+items = "item"
+minitems = 4
+maxitems = 4
+uniqueitems = true
+padwithfallback = "fallback"
+
+[types.item]
+type = "string"
+enum = ["a", "b"]
+
+[types.fallback]
+type = "string"
+enum = ["c", "d", "e", "f"]
+`
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(MustParseTemplate(data), WithRand(rng))
+	doc, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if n := len(doc.([]any)); n != 4 {
+		t.Errorf("array has %d items, expected 4", n)
+	}
+
+	// Without padding not enough unique items can be generated.
+	noPad := strings.Replace(data, `padwithfallback = "fallback"`, "", 1)
+	gen = NewGenerator(MustParseTemplate(noPad), WithRand(rng))
+	if _, err := gen.Generate(); err == nil {
+		t.Error("Generate succeeded without padding")
+	}
+}
+
+func TestWeightedOneOf(t *testing.T) {
+	const data = `
+root = "category"
+
+[types.category]
+type = "weighted_oneof"
+
+[[types.category.choices]]
+type = "common"
+weight = 9
+
+[[types.category.choices]]
+type = "rare"
+weight = 1
+
+[types.common]
+type = "const"
+value = "common"
+
+[types.rare]
+type = "const"
+value = "rare"
+`
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(MustParseTemplate(data), WithRand(rng))
+	counts := make(map[any]int)
+	for range 1000 {
+		value, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		counts[value]++
+	}
+	if counts["common"] < 800 || counts["rare"] < 50 {
+		t.Errorf("unexpected distribution %v", counts)
+	}
+
+	bad := strings.Replace(data, "weight = 1\n", "weight = 0\n", 1)
+	if _, err := ParseTemplate(bad); err == nil {
+		t.Error("ParseTemplate accepted weight 0")
+	}
+}
+
+func TestAbstractSubtypes(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "shape"
+
+[types.shape]
+type = "object"
+abstractsubtypes = ["circle", "square"]
+minproperties = 5
+
+[types.circle]
+type = "object"
+[[types.circle.properties]]
+name = "radius"
+type = "size"
+required = true
+
+[types.square]
+type = "object"
+[[types.square.properties]]
+name = "side"
+type = "size"
+required = true
+
+[types.size]
+type = "number"
+minimum = 1
+maximum = 10
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 10 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		obj := doc.(map[string]any)
+		_, circle := obj["radius"]
+		_, square := obj["side"]
+		if len(obj) != 1 || circle == square {
+			t.Errorf("%v is not generated from one of the subtypes", obj)
+		}
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(&Template{}, WithRand(rng))
+	for _, test := range []struct {
+		fold     CaseFold
+		expected string
+	}{
+		{CaseUnchanged, "Example vendor ÄG"},
+		{CaseUpper, "EXAMPLE VENDOR ÄG"},
+		{CaseLower, "example vendor äg"},
+		{CaseTitle, "Example Vendor ÄG"},
+	} {
+		if got := gen.foldCase("Example vendor ÄG", test.fold); got != test.expected {
+			t.Errorf("foldCase(%q) = %q, expected %q", test.fold, got, test.expected)
+		}
+	}
+	if got := gen.foldCase("Example", CaseRandom); !strings.EqualFold(got, "Example") {
+		t.Errorf("random case of %q changed more than the case: %q", "Example", got)
+	}
+}
+
+func TestGenerateWithContext(t *testing.T) {
+	// Every branch of the oneof recurses, so the generator tries all
+	// combinations until the maximum depth is exceeded, which takes
+	// practically forever.
+	templ := MustParseTemplate(`
+root = "loop"
+
+[types.loop]
+type = "oneof"
+oneof = ["loop", "loop", "loop"]
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+
+	const timeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	_, err = gen.GenerateWithContext(ctx)
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("generation took %v, expected at most %v", elapsed, 2*timeout)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestGeneratorOptions(t *testing.T) {
+	templ := productTemplate()
+	gen := NewGenerator(templ)
+	if gen.Rand == nil || gen.Limits != nil || gen.SizeFactor != 1 || gen.MaxDepth != maxDepth {
+		t.Errorf("unexpected defaults: %+v", gen)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := &Limits{}
+	gen = NewGenerator(templ,
+		WithLimits(limits),
+		WithRand(rng),
+		WithSizeFactor(0.5),
+		WithMaxDepth(10),
+	)
+	if gen.Rand != rng || gen.Limits != limits || gen.SizeFactor != 0.5 || gen.MaxDepth != 10 {
+		t.Errorf("options not applied: %+v", gen)
+	}
+
+	legacy := NewGeneratorLegacy(templ, limits, rng)
+	if legacy.Rand != rng || legacy.Limits != limits {
+		t.Errorf("legacy constructor did not apply arguments: %+v", legacy)
+	}
+}
+
+// chainTemplate returns a template of objects nested levels deep with a
+// string in the innermost object.
+func chainTemplate(levels int) *Template {
+	templ := &Template{
+		Root:  "level0",
+		Types: map[string]TmplNode{"leaf": &TmplString{MinLength: 1, MaxLength: 5}},
+	}
+	for i := range levels {
+		next := fmt.Sprintf("level%d", i+1)
+		if i == levels-1 {
+			next = "leaf"
+		}
+		templ.Types[fmt.Sprintf("level%d", i)] = &TmplObject{
+			Properties:    []*Property{{Name: "next", Type: next, Required: true}},
+			MinProperties: -1,
+			MaxProperties: -1,
+		}
+	}
+	return templ
+}
+
+func TestNewGeneratorFromOptions(t *testing.T) {
+	defaults := GeneratorOptions{}.Defaults()
+	if defaults.Rand == nil || defaults.SizeFactor != 0.00001 ||
+		defaults.MaxDepth != maxDepth || defaults.OptionalProbability != 0.5 ||
+		defaults.ForceMaxSize || defaults.RequireRegex != nil {
+		t.Errorf("unexpected defaults: %+v", defaults)
+	}
+
+	// Zero values get the defaults of NewGenerator, not those of
+	// Defaults, so both constructors generate the same documents.
+	for _, seed := range []string{"pcg:1:2", "pcg:3:4"} {
+		rng1, err := ParseSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng2, _ := ParseSeed(seed)
+		fromOpts := NewGeneratorFromOptions(GeneratorOptions{
+			Template: sizeTemplate(),
+			Rand:     rng1,
+		})
+		plain := NewGenerator(sizeTemplate(), WithRand(rng2))
+		if fromOpts.SizeFactor != plain.SizeFactor || fromOpts.MaxDepth != plain.MaxDepth ||
+			fromOpts.OptionalProbability != plain.OptionalProbability {
+			t.Errorf("different defaults: %+v and %+v", fromOpts, plain)
+		}
+		for range 10 {
+			if a, b := MustGenerate(fromOpts), MustGenerate(plain); !reflect.DeepEqual(a, b) {
+				t.Fatalf("different documents %v and %v", a, b)
+			}
+		}
+	}
+
+	// The values of Defaults lead to minimal documents.
+	small := GeneratorOptions{Template: sizeTemplate(), Rand: defaults.Rand}.Defaults()
+	gen := NewGeneratorFromOptions(small)
+	if gen.SizeFactor != 0.00001 || gen.OptionalProbability != 0.5 {
+		t.Errorf("defaults not applied: %+v", gen)
+	}
+	for range 10 {
+		if doc := MustGenerate(gen).(map[string]any); len(doc) > 1 {
+			t.Fatalf("document with defaults is %v", doc)
+		}
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := &Limits{}
+	gen = NewGeneratorFromOptions(GeneratorOptions{
+		Template:   chainTemplate(5),
+		Limits:     limits,
+		SizeFactor: 0.5,
+		Rand:       rng,
+		MaxDepth:   5,
+	})
+	if gen.Rand != rng || gen.Limits != limits || gen.SizeFactor != 0.5 || gen.MaxDepth != 5 {
+		t.Errorf("options not applied: %+v", gen)
+	}
+	if _, err := gen.Generate(); !errors.Is(err, ErrDepthExceeded) {
+		t.Errorf("got error %v, want ErrDepthExceeded", err)
+	}
+
+	gen = NewGeneratorFromOptions(GeneratorOptions{
+		Template: chainTemplate(5),
+		Rand:     rng,
+		MaxDepth: 6,
+	})
+	if _, err := gen.Generate(); err != nil {
+		t.Errorf("Generate failed: %v", err)
+	}
+
+	re := regexp.MustCompile(`x`)
+	gen = NewGeneratorFromOptions(GeneratorOptions{
+		Template:            chainTemplate(1),
+		ForceMaxSize:        true,
+		RequireRegex:        re,
+		OptionalProbability: 0.25,
+	})
+	if !gen.ForceMaxSize || gen.RequireRegex != re || gen.OptionalProbability != 0.25 {
+		t.Errorf("options not applied: %+v", gen)
+	}
+}
+
+func sizeTemplate() *Template {
+	return MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "list"
+type = "list"
+
+[[types.doc.properties]]
+name = "a"
+type = "value"
+
+[[types.doc.properties]]
+name = "b"
+type = "value"
+
+[[types.doc.properties]]
+name = "c"
+type = "value"
+
+[types.list]
+type = "array"
+items = "value"
+minitems = 1
+maxitems = 5
+
+[types.value]
+type = "string"
+enum = ["x", "y"]
+`)
+}
+
+func TestForceMaxSize(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(sizeTemplate(), WithRand(rng), WithForceMaxSize(true))
+	for range 10 {
+		doc := MustGenerate(gen).(map[string]any)
+		if len(doc) != 4 {
+			t.Fatalf("object has %d properties, expected 4", len(doc))
+		}
+		if n := len(doc["list"].([]any)); n != 5 {
+			t.Fatalf("array has %d items, expected 5", n)
+		}
+	}
+}
+
+func TestOptionalProbability(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, probability := range []float64{0.2, 0.8} {
+		gen := NewGenerator(sizeTemplate(), WithRand(rng),
+			WithOptionalProbability(probability))
+		const rounds = 500
+		total := 0
+		for range rounds {
+			total += len(MustGenerate(gen).(map[string]any))
+		}
+		if mean, want := float64(total)/rounds, 4*probability; math.Abs(mean-want) > 0.3 {
+			t.Errorf("probability %g: mean of %g properties, expected about %g",
+				probability, mean, want)
+		}
+	}
+}
+
+func TestRequireRegex(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`"a":"y"`)
+	gen := NewGenerator(sizeTemplate(), WithRand(rng), WithRequireRegex(re))
+	for range 10 {
+		data, err := gen.GenerateJSON(false)
+		if err != nil {
+			t.Fatalf("GenerateJSON failed: %v", err)
+		}
+		if !re.Match(data) {
+			t.Fatalf("document %s does not match %s", data, re)
+		}
+	}
+
+	gen = NewGenerator(sizeTemplate(), WithRand(rng),
+		WithRequireRegex(regexp.MustCompile(`"z"`)))
+	if _, err := gen.Generate(); !errors.Is(err, ErrNoValidValue) {
+		t.Errorf("got error %v, expected ErrNoValidValue", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(chainTemplate(3), WithRand(rng), WithMaxDepth(2))
+	if _, err := gen.Generate(); !errors.Is(err, ErrDepthExceeded) {
+		t.Errorf("depth 2: got error %v, want ErrDepthExceeded", err)
+	}
+
+	deep := chainTemplate(40)
+	gen = NewGenerator(deep, WithRand(rng))
+	if _, err := gen.Generate(); !errors.Is(err, ErrDepthExceeded) {
+		t.Errorf("default depth: got error %v, want ErrDepthExceeded", err)
+	}
+	gen = NewGenerator(deep, WithRand(rng), WithMaxDepth(50))
+	if _, err := gen.Generate(); err != nil {
+		t.Errorf("depth 50: Generate failed: %v", err)
+	}
+}
+
+func TestProgressFunc(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(productTemplate(), WithRand(rng))
+	counts := make(map[string]int)
+	phases := make(map[string]int)
+	lastCount := 0
+	gen.ProgressFunc = func(event ProgressEvent) {
+		phases[event.Phase]++
+		if event.Phase == "node" {
+			counts[event.TypeName]++
+			lastCount = event.Count
+		}
+	}
+	if _, err := gen.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	for _, typename := range []string{"doc", "products", "product_ref"} {
+		if counts[typename] == 0 {
+			t.Errorf("no progress reported for type %q", typename)
+		}
+	}
+	if counts["product_id"] != 3 {
+		t.Errorf("progress reported for %d product IDs, expected 3", counts["product_id"])
+	}
+	if phases["array_item"] != 3 || phases["fixup"] != 1 {
+		t.Errorf("unexpected phases %v", phases)
+	}
+	if lastCount != phases["node"] {
+		t.Errorf("last node count is %d, expected %d", lastCount, phases["node"])
+	}
+}
+
+func TestLengthBoundsReachable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("abc ", 10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(&Template{}, WithRand(rng))
+
+	lorem := func(minlength, maxlength int) int {
+		return len(strings.Fields(gen.loremIpsum(minlength, maxlength, LoremWords, nil, nil)))
+	}
+	book := func(minlength, maxlength int) int {
+		s, err := gen.book(minlength, maxlength, path, false)
+		if err != nil {
+			t.Fatalf("book failed: %v", err)
+		}
+		return utf8.RuneCountInString(s)
+	}
+	for name, length := range map[string]func(int, int) int{
+		"loremIpsum": lorem,
+		"book":       book,
+	} {
+		if n := length(5, 5); n != 5 {
+			t.Errorf("%s: length %d, expected 5", name, n)
+		}
+		maxSeen := false
+		for range 1000 {
+			n := length(0, 10)
+			if n < 0 || n > 10 {
+				t.Fatalf("%s: length %d out of range 0..10", name, n)
+			}
+			maxSeen = maxSeen || n == 10
+		}
+		if !maxSeen {
+			t.Errorf("%s: maximum length 10 never generated", name)
+		}
+	}
+}
+
+func TestStringWords(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "fixed"
+type = "fixed"
+required = true
+
+[[types.doc.properties]]
+name = "range"
+type = "range"
+required = true
+
+[types.fixed]
+type = "string"
+minwords = 3
+maxwords = 3
+
+[types.range]
+type = "string"
+minwords = 2
+maxwords = 4
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 100 {
+		doc := MustGenerate(gen).(map[string]any)
+		if n := len(strings.Fields(doc["fixed"].(string))); n != 3 {
+			t.Fatalf("fixed string has %d words, expected 3", n)
+		}
+		if n := len(strings.Fields(doc["range"].(string))); n < 2 || n > 4 {
+			t.Fatalf("string has %d words, expected 2 to 4", n)
+		}
+	}
+
+	if _, err := ParseTemplate(`
+[types.words]
+type = "string"
+minwords = 4
+maxwords = 3
+`); err == nil {
+		t.Error("ParseTemplate accepted minwords > maxwords")
+	}
+}
+
+func TestStubBranches(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatalf("FromCSAFSchema failed: %v", err)
+	}
+	branch, ok := templ.Types["csaf:#/$defs/branches_t/items"].(*TmplObject)
+	if !ok || !branch.Stub {
+		t.Fatalf("product tree branches are not stubs: %#v", branch)
+	}
+	if name := templ.Types["csaf:#/$defs/full_product_name_t"].(*TmplObject); name.Stub {
+		t.Error("full product names are stubs")
+	}
+
+	// A stub object only gets the properties needed to reach
+	// minproperties close to the maximum depth.
+	stub := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+stub = true
+
+[[types.doc.properties]]
+name = "required"
+type = "value"
+required = true
+
+[[types.doc.properties]]
+name = "a"
+type = "value"
+
+[[types.doc.properties]]
+name = "b"
+type = "value"
+
+[types.value]
+type = "const"
+value = "x"
+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(stub, WithRand(rng), WithForceMaxSize(true))
+	if doc := MustGenerate(gen).(map[string]any); len(doc) != 3 {
+		t.Errorf("object far from the maximum depth is %v", doc)
+	}
+	gen = NewGenerator(stub, WithRand(rng), WithForceMaxSize(true), WithMaxDepth(2))
+	if doc := MustGenerate(gen).(map[string]any); len(doc) != 1 {
+		t.Errorf("stub object is %v", doc)
+	}
+}
+
+func TestPropertyFilter(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+propertyfilter = ["b", "c"]
+
+[[types.doc.properties]]
+name = "a"
+type = "value"
+required = true
+
+[[types.doc.properties]]
+name = "b"
+type = "value"
+required = true
+
+[[types.doc.properties]]
+name = "c"
+type = "value"
+
+[[types.doc.properties]]
+name = "d"
+type = "value"
+
+[types.value]
+type = "const"
+value = "x"
+`)
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	if got := loaded.Types["doc"].(*TmplObject).PropertyFilter; !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("loaded property filter %v", got)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	seenD := false
+	for range 50 {
+		doc := MustGenerate(gen).(map[string]any)
+		if _, ok := doc["a"]; !ok {
+			t.Fatalf("required property missing: %v", doc)
+		}
+		for _, name := range []string{"b", "c"} {
+			if _, ok := doc[name]; ok {
+				t.Fatalf("filtered property %q generated: %v", name, doc)
+			}
+		}
+		_, ok := doc["d"]
+		seenD = seenD || ok
+	}
+	if !seenD {
+		t.Error("optional property that is not filtered was never generated")
+	}
+}
+
+func TestRequiredOverrides(t *testing.T) {
+	templ := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "vuln"
+type = "vuln"
+required = true
+
+[[types.doc.properties]]
+name = "severity"
+type = "value"
+
+[types.vuln]
+type = "object"
+requiredoverrides = ["severity"]
+
+[[types.vuln.properties]]
+name = "severity"
+type = "value"
+
+[[types.vuln.properties]]
+name = "notes"
+type = "value"
+
+[types.value]
+type = "const"
+value = "x"
+`)
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	if got := loaded.Types["vuln"].(*TmplObject).RequiredOverrides; !slices.Equal(got, []string{"severity"}) {
+		t.Errorf("loaded required overrides %v", got)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	omitted := false
+	for range 50 {
+		doc := MustGenerate(gen).(map[string]any)
+		if _, ok := doc["vuln"].(map[string]any)["severity"]; !ok {
+			t.Fatalf("overridden property missing: %v", doc)
+		}
+		// The override is scoped to the vuln type.
+		_, ok := doc["severity"]
+		omitted = omitted || !ok
+	}
+	if !omitted {
+		t.Error("override applied to a property of another type")
+	}
+}
+
+func TestProfilingReport(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(productTemplate(), WithRand(rng))
+	MustGenerate(gen)
+	if report := gen.ProfilingReport(); strings.Contains(report, "product_id") {
+		t.Errorf("report without profiling:\n%s", report)
+	}
+
+	gen.ProfilingEnabled = true
+	for range 2 {
+		MustGenerate(gen)
+	}
+	lines := strings.Split(strings.TrimSpace(gen.ProfilingReport()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "TOTAL") {
+		t.Fatalf("unexpected report:\n%s", strings.Join(lines, "\n"))
+	}
+	// The root type includes the time of all nested types.
+	if fields := strings.Fields(lines[1]); fields[len(fields)-1] != "doc" {
+		t.Errorf("root type is not the slowest:\n%s", strings.Join(lines, "\n"))
+	}
+	calls := make(map[string]string)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		calls[fields[len(fields)-1]] = fields[1]
+	}
+	want := map[string]string{
+		"doc": "2", "products": "2", "product_id": "6", "product_ref": "2",
+	}
+	if !maps.Equal(calls, want) {
+		t.Errorf("calls: got %v, want %v", calls, want)
+	}
+}
+
+func TestChooseLength(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(&Template{}, WithRand(rng))
+	for _, tc := range []struct{ minlength, maxlength int }{
+		{0, 0},
+		{1, 1},
+		{5, 5},
+		{0, 1},
+		{3, 10},
+	} {
+		seen := make(map[int]bool)
+		for range 1000 {
+			n := gen.chooseLength(tc.minlength, tc.maxlength)
+			if n < tc.minlength || n > tc.maxlength {
+				t.Fatalf("chooseLength(%d, %d) = %d", tc.minlength, tc.maxlength, n)
+			}
+			seen[n] = true
+		}
+		if len(seen) != tc.maxlength-tc.minlength+1 {
+			t.Errorf("chooseLength(%d, %d) generated only %d different lengths",
+				tc.minlength, tc.maxlength, len(seen))
+		}
+	}
+}
+
+func TestLengthDistribution(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(&Template{}, WithRand(rng))
+
+	const span, rounds = 20, 2000
+	mean := func(dist LengthDistribution) float64 {
+		sum := 0
+		for range rounds {
+			n := gen.arrayLength(span, dist)
+			if n < 0 || n > span {
+				t.Fatalf("%s: length %d out of range 0..%d", dist, n, span)
+			}
+			sum += n
+		}
+		return float64(sum) / rounds
+	}
+	for _, tc := range []struct {
+		dist      LengthDistribution
+		low, high float64
+	}{
+		{LengthUniform, 9, 11},
+		{"", 9, 11},
+		{LengthGeometric, 4, 6},
+		{LengthPoisson, 9, 11},
+	} {
+		if m := mean(tc.dist); m < tc.low || m > tc.high {
+			t.Errorf("%q: mean length %g, expected between %g and %g",
+				tc.dist, m, tc.low, tc.high)
+		}
+	}
+
+	// Poisson lengths cluster around the middle of the range, so they
+	// hit the bounds much less often than uniform lengths.
+	atBounds := func(dist LengthDistribution) int {
+		count := 0
+		for range rounds {
+			if n := gen.arrayLength(span, dist); n == 0 || n == span {
+				count++
+			}
+		}
+		return count
+	}
+	if p, u := atBounds(LengthPoisson), atBounds(LengthUniform); p >= u/4 {
+		t.Errorf("poisson lengths at bounds %d times, uniform %d times", p, u)
+	}
+}
+
+func TestLengthDistributionRoundTrip(t *testing.T) {
+	for _, dist := range []LengthDistribution{
+		"", LengthUniform, LengthGeometric, LengthPoisson,
+	} {
+		templ := &Template{
+			Root: "list",
+			Types: map[string]TmplNode{
+				"list": &TmplArray{
+					Items:              "item",
+					MinItems:           -1,
+					MaxItems:           -1,
+					LengthDistribution: dist,
+				},
+				"item": &TmplConst{Value: "x"},
+			},
+		}
+		var buf bytes.Buffer
+		if err := templ.Write(&buf); err != nil {
+			t.Fatalf("%q: Write failed: %v", dist, err)
+		}
+		loaded, err := LoadTemplateFromReader(&buf)
+		if err != nil {
+			t.Fatalf("%q: LoadTemplateFromReader failed: %v", dist, err)
+		}
+		want := dist
+		if want == "" {
+			want = LengthUniform
+		}
+		if got := loaded.Types["list"].(*TmplArray).LengthDistribution; got != want {
+			t.Errorf("%q: loaded distribution %q, expected %q", dist, got, want)
+		}
+	}
+
+	if _, err := ParseTemplate(`
+[types.list]
+type = "array"
+items = "item"
+lengthdistribution = "normal"
+`); err == nil {
+		t.Error("ParseTemplate accepted an unknown length distribution")
+	}
+}
+
+func TestGenerateJSON(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatalf("FromCSAFSchema failed: %v", err)
+	}
+	newGenerator := func() *Generator {
+		rng, err := ParseSeed("pcg:1:2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewGenerator(templ, WithRand(rng))
+	}
+
+	for _, formatted := range []bool{false, true} {
+		data, err := newGenerator().GenerateJSON(formatted)
+		if err != nil {
+			t.Fatalf("GenerateJSON failed: %v", err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("GenerateJSON returned invalid JSON: %v", err)
+		}
+		if _, ok := doc["document"]; !ok {
+			t.Error("generated document has no document property")
+		}
+
+		var buf bytes.Buffer
+		if err := newGenerator().GenerateWriter(&buf, formatted); err != nil {
+			t.Fatalf("GenerateWriter failed: %v", err)
+		}
+		if !bytes.Equal(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), data) {
+			t.Errorf("formatted=%t: GenerateWriter and GenerateJSON differ", formatted)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"regexp"
 	"strings"
@@ -28,7 +29,8 @@ type PathEntry struct {
 type Path []PathEntry
 
 // LengthPaths stores a length limits ans the paths which
-// the limit should apply to.
+// the limit should apply to. An empty path applies to all values of
+// the document.
 type LengthPaths struct {
 	Length int    `json:"length"`
 	Paths  []Path `json:"paths"`
@@ -42,6 +44,255 @@ type Limits struct {
 	URIs        []LengthPaths `json:"uris"`
 }
 
+// Merge returns a new Limits combining base and overlay. The length
+// limits of overlay are appended to those of base. The file size of
+// overlay replaces that of base if it is not zero. Either of base and
+// overlay may be nil.
+func (base *Limits) Merge(overlay *Limits) *Limits {
+	merged := new(Limits)
+	for _, lim := range []*Limits{base, overlay} {
+		if lim == nil {
+			continue
+		}
+		if lim.FileSize != 0 {
+			merged.FileSize = lim.FileSize
+		}
+		merged.ArrayLength = append(merged.ArrayLength, lim.ArrayLength...)
+		merged.Strings = append(merged.Strings, lim.Strings...)
+		merged.URIs = append(merged.URIs, lim.URIs...)
+	}
+	return merged
+}
+
+// ArrayLimits returns the tree of the array length limits. It's nil if
+// there are no such limits.
+func (lim *Limits) ArrayLimits() *LimitNode {
+	if lim == nil {
+		return nil
+	}
+	return newLimitTree(lim.ArrayLength)
+}
+
+// StringLimits returns the tree of the string length limits. It's nil
+// if there are no such limits.
+func (lim *Limits) StringLimits() *LimitNode {
+	if lim == nil {
+		return nil
+	}
+	return newLimitTree(lim.Strings)
+}
+
+// URILimits returns the tree of the URI length limits. It's nil if
+// there are no such limits.
+func (lim *Limits) URILimits() *LimitNode {
+	if lim == nil {
+		return nil
+	}
+	return newLimitTree(lim.URIs)
+}
+
+// LimitNode is a node in a tree of length limits built from the paths
+// of a list of LengthPaths. The tree is navigated along with the
+// properties of the generated document with Descend. The items of an
+// array share the node of the array, so path entries are matched by
+// name only. A nil *LimitNode is a valid node without any limits.
+type LimitNode struct {
+	// Limit is the length limit of the values at this node. 0 means
+	// that there is no limit for this node.
+	Limit int
+
+	// Children holds the nodes of the properties of the values at
+	// this node.
+	Children map[string]*LimitNode
+
+	// RecursiveBranches holds the nodes of the recursive path entries,
+	// i.e. the entries that may be repeated any number of times. The
+	// node of a recursive entry is its own recursive branch for the
+	// name of the entry.
+	RecursiveBranches map[string]*LimitNode
+
+	// global is the limit of the empty paths which apply to all values.
+	global int
+}
+
+// newLimitTree builds the tree for the given length limits. It returns
+// nil if there are no limits.
+func newLimitTree(lengths []LengthPaths) *LimitNode {
+	if len(lengths) == 0 {
+		return nil
+	}
+	root := new(LimitNode)
+	for _, lp := range lengths {
+		for _, path := range lp.Paths {
+			if len(path) == 0 {
+				root.global = minLimit(root.global, lp.Length)
+			}
+		}
+	}
+	for _, lp := range lengths {
+		for _, path := range lp.Paths {
+			root.insert(path, lp.Length)
+		}
+	}
+	return root
+}
+
+// minLimit returns the smaller of the limits a and b where 0 means
+// that there is no limit.
+func minLimit(a, b int) int {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	}
+	return min(a, b)
+}
+
+// newChild creates a node to be inserted below ln.
+func (ln *LimitNode) newChild() *LimitNode {
+	return &LimitNode{global: ln.global}
+}
+
+// insert adds the limit for the path relative to ln. A recursive entry
+// matches zero or more occurrences of its name, so the rest of the
+// path is inserted both at ln and at the recursive branch.
+func (ln *LimitNode) insert(path Path, limit int) {
+	if len(path) == 0 {
+		ln.Limit = minLimit(ln.Limit, limit)
+		return
+	}
+	entry, rest := path[0], path[1:]
+	if entry.Recursive {
+		ln.insert(rest, limit)
+		branch := ln.RecursiveBranches[entry.Name]
+		if branch == nil {
+			branch = ln.newChild()
+			branch.RecursiveBranches = map[string]*LimitNode{entry.Name: branch}
+			if ln.RecursiveBranches == nil {
+				ln.RecursiveBranches = make(map[string]*LimitNode)
+			}
+			ln.RecursiveBranches[entry.Name] = branch
+		}
+		branch.insert(rest, limit)
+		return
+	}
+	child := ln.Children[entry.Name]
+	if child == nil {
+		child = ln.newChild()
+		if ln.Children == nil {
+			ln.Children = make(map[string]*LimitNode)
+		}
+		ln.Children[entry.Name] = child
+	}
+	child.insert(rest, limit)
+}
+
+// Descend returns the node for the property name of the values at ln.
+// If the name matches both a child and a recursive branch, the result
+// combines both. The result is nil if no limits apply to the property.
+func (ln *LimitNode) Descend(name string) *LimitNode {
+	if ln == nil {
+		return nil
+	}
+	next := mergeLimitNodes(
+		ln.Children[name],
+		ln.RecursiveBranches[name],
+		make(map[[2]*LimitNode]*LimitNode),
+	)
+	if next == nil && ln.global > 0 {
+		next = &LimitNode{global: ln.global}
+	}
+	return next
+}
+
+// GetLimit returns the length limit for the values at ln. 0 means that
+// there's no limit.
+func (ln *LimitNode) GetLimit() int {
+	if ln == nil {
+		return 0
+	}
+	return minLimit(ln.Limit, ln.global)
+}
+
+// mergeLimitNodes returns a node combining the limits and the branches
+// of a and b. Because of the recursive branches the nodes may form
+// cycles, so the nodes already merged are recorded in merged.
+func mergeLimitNodes(a, b *LimitNode, merged map[[2]*LimitNode]*LimitNode) *LimitNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil, a == b:
+		return a
+	}
+	key := [2]*LimitNode{a, b}
+	if m := merged[key]; m != nil {
+		return m
+	}
+	m := &LimitNode{
+		Limit:  minLimit(a.Limit, b.Limit),
+		global: minLimit(a.global, b.global),
+	}
+	merged[key] = m
+	m.Children = mergeLimitMaps(a.Children, b.Children, merged)
+	m.RecursiveBranches = mergeLimitMaps(a.RecursiveBranches, b.RecursiveBranches, merged)
+	return m
+}
+
+// mergeLimitMaps merges the node maps a and b with mergeLimitNodes.
+func mergeLimitMaps(a, b map[string]*LimitNode, merged map[[2]*LimitNode]*LimitNode) map[string]*LimitNode {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	m := make(map[string]*LimitNode, len(a)+len(b))
+	for name, node := range a {
+		m[name] = mergeLimitNodes(node, b[name], merged)
+	}
+	for name, node := range b {
+		if _, ok := m[name]; !ok {
+			m[name] = node
+		}
+	}
+	return m
+}
+
+// Scale returns a new Limits with the file size and all length limits
+// of lim multiplied by factor and rounded to the nearest integer.
+// Limits are not scaled below 1, because 0 would mean no limit. The
+// paths are shared with lim.
+func (lim *Limits) Scale(factor float64) *Limits {
+	if lim == nil {
+		return nil
+	}
+	scaleLengths := func(lengths []LengthPaths) []LengthPaths {
+		if lengths == nil {
+			return nil
+		}
+		scaled := make([]LengthPaths, len(lengths))
+		for i, lp := range lengths {
+			scaled[i] = LengthPaths{
+				Length: int(scaleLimit(int64(lp.Length), factor)),
+				Paths:  lp.Paths,
+			}
+		}
+		return scaled
+	}
+	return &Limits{
+		FileSize:    scaleLimit(lim.FileSize, factor),
+		ArrayLength: scaleLengths(lim.ArrayLength),
+		Strings:     scaleLengths(lim.Strings),
+		URIs:        scaleLengths(lim.URIs),
+	}
+}
+
+// scaleLimit multiplies limit by factor. Positive limits stay positive.
+func scaleLimit(limit int64, factor float64) int64 {
+	if limit <= 0 {
+		return limit
+	}
+	return max(1, int64(math.Round(float64(limit)*factor)))
+}
+
 var recursionRe = regexp.MustCompile(`\(/[^)]+\)\*`)
 
 // UnmarshalText implements [encoding/TextUnmarshaler].
@@ -0,0 +1,291 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustLoadLimits(t *testing.T, s string) *Limits {
+	t.Helper()
+	limits, err := LoadLimitsFromReader(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return limits
+}
+
+func TestLimitNodeDescend(t *testing.T) {
+	limits := mustLoadLimits(t, `{
+  "arrays": [
+    {"length": 5, "paths": ["/product_tree/branches[]*"]},
+    {"length": 7, "paths": ["/product_tree(/branches[])*/branches"]},
+    {"length": 3, "paths": ["/product_tree/branches[](/branches[])*/product/hashes"]},
+    {"length": 2, "paths": ["/document/notes"]}
+  ]
+}`)
+	root := limits.ArrayLimits()
+
+	for _, tc := range []struct {
+		path []string
+		want int
+	}{
+		{[]string{"document", "notes"}, 2},
+		{[]string{"document", "references"}, 0},
+		{[]string{"product_tree", "branches"}, 5},
+		{[]string{"product_tree", "branches", "branches"}, 5},
+		{[]string{"product_tree", "branches", "branches", "branches"}, 5},
+		{[]string{"product_tree", "branches", "product", "hashes"}, 3},
+		{[]string{"product_tree", "branches", "branches", "product", "hashes"}, 3},
+		{[]string{"product_tree", "product", "hashes"}, 0},
+		{[]string{"vulnerabilities"}, 0},
+	} {
+		node := root
+		for _, name := range tc.path {
+			node = node.Descend(name)
+		}
+		if got := node.GetLimit(); got != tc.want {
+			t.Errorf("limit of /%s: got %d, want %d",
+				strings.Join(tc.path, "/"), got, tc.want)
+		}
+	}
+}
+
+func TestLimitNodeGlobal(t *testing.T) {
+	limits := (&Limits{}).Merge(&Limits{
+		ArrayLength: []LengthPaths{{Length: 4, Paths: []Path{{}}}},
+	}).Merge(mustLoadLimits(t, `{
+  "arrays": [
+    {"length": 10, "paths": ["/a/b"]},
+    {"length": 2, "paths": ["/a/c"]}
+  ]
+}`))
+	root := limits.ArrayLimits()
+	for _, tc := range []struct {
+		path []string
+		want int
+	}{
+		{[]string{"a"}, 4},
+		{[]string{"a", "b"}, 4},
+		{[]string{"a", "c"}, 2},
+		{[]string{"x", "y", "z"}, 4},
+	} {
+		node := root
+		for _, name := range tc.path {
+			node = node.Descend(name)
+		}
+		if got := node.GetLimit(); got != tc.want {
+			t.Errorf("limit of /%s: got %d, want %d",
+				strings.Join(tc.path, "/"), got, tc.want)
+		}
+	}
+
+	var none *Limits
+	if none.ArrayLimits() != nil {
+		t.Error("nil limits have an array limit tree")
+	}
+}
+
+func TestArrayLimitsApplied(t *testing.T) {
+	templ := &Template{
+		Root: "root",
+		Types: map[string]TmplNode{
+			"root": &TmplObject{
+				Properties: []*Property{
+					{Name: "limited", Type: "array", Required: true},
+					{Name: "free", Type: "array", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"array":  &TmplArray{Items: "string", MinItems: 0, MaxItems: 20},
+			"string": &TmplString{MinLength: 1, MaxLength: 4},
+		},
+	}
+	limits := mustLoadLimits(t, `{
+  "arrays": [{"length": 3, "paths": ["/limited"]}]
+}`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithLimits(limits), WithRand(rng))
+	longest := 0
+	for range 50 {
+		doc := MustGenerate(gen).(map[string]any)
+		if n := len(doc["limited"].([]any)); n > 3 {
+			t.Fatalf("limited array has %d items", n)
+		}
+		longest = max(longest, len(doc["free"].([]any)))
+	}
+	if longest <= 3 {
+		t.Errorf("limit applied to other array, longest has %d items", longest)
+	}
+}
+
+func TestReferenceArrayLimitsApplied(t *testing.T) {
+	templ := &Template{
+		Root: "root",
+		Types: map[string]TmplNode{
+			"root": &TmplObject{
+				Properties: []*Property{
+					{Name: "ids", Type: "ids", Required: true},
+					{Name: "refs", Type: "refs", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"ids":  &TmplArray{Items: "id", MinItems: 10, MaxItems: 10},
+			"id":   &TmplID{Namespace: "ns"},
+			"refs": &TmplArray{Items: "ref", MinItems: 1, MaxItems: -1, UniqueItems: true},
+			"ref":  &TmplRef{Namespace: "ns"},
+		},
+	}
+	longest := func(limits *Limits) int {
+		rng, err := ParseSeed("pcg:1:2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen := NewGenerator(templ, WithLimits(limits), WithRand(rng))
+		n := 0
+		for range 50 {
+			var doc struct {
+				Refs []string `json:"refs"`
+			}
+			if err := json.Unmarshal(MustGenerateJSON(gen, false), &doc); err != nil {
+				t.Fatalf("unexpected document structure: %v", err)
+			}
+			n = max(n, len(doc.Refs))
+		}
+		return n
+	}
+	if n := longest(nil); n <= 3 {
+		t.Errorf("without limits the longest reference array has %d items", n)
+	}
+	limits := mustLoadLimits(t, `{
+  "arrays": [{"length": 3, "paths": ["/refs"]}]
+}`)
+	if n := longest(limits); n > 3 {
+		t.Errorf("limited reference array has %d items", n)
+	}
+}
+
+func TestStringLimitsApplied(t *testing.T) {
+	templ := &Template{
+		Root: "root",
+		Types: map[string]TmplNode{
+			"root": &TmplObject{
+				Properties: []*Property{
+					{Name: "name", Type: "string", Required: true},
+					{Name: "other", Type: "string", Required: true},
+					{Name: "url", Type: "uri", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"string": &TmplString{MinLength: 10, MaxLength: 40},
+			"uri":    &TmplString{MinLength: 10, MaxLength: 40, URI: true},
+		},
+	}
+	limits := mustLoadLimits(t, `{
+  "strings": [{"length": 12, "paths": ["/name"]}],
+  "uris": [{"length": 15, "paths": [""]}]
+}`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithLimits(limits), WithRand(rng))
+	longest := 0
+	for range 50 {
+		doc := MustGenerate(gen).(map[string]any)
+		if n := len(doc["name"].(string)); n > 12 {
+			t.Fatalf("limited string has length %d", n)
+		}
+		if n := len(doc["url"].(string)); n > 15 {
+			t.Fatalf("limited URI has length %d", n)
+		}
+		longest = max(longest, len(doc["other"].(string)))
+	}
+	if longest <= 15 {
+		t.Errorf("limits applied to other string, longest has length %d", longest)
+	}
+}
+
+func TestLimitsMerge(t *testing.T) {
+	base := mustLoadLimits(t, `{
+  "file_size": 1000,
+  "arrays": [{"length": 10, "paths": ["/a"]}],
+  "strings": [{"length": 20, "paths": ["/s"]}]
+}`)
+	overlay := mustLoadLimits(t, `{
+  "arrays": [{"length": 5, "paths": ["/b"]}],
+  "uris": [{"length": 30, "paths": ["/u"]}]
+}`)
+
+	merged := base.Merge(overlay)
+	if merged.FileSize != 1000 {
+		t.Errorf("file size: got %d, want 1000", merged.FileSize)
+	}
+	if n := len(merged.ArrayLength); n != 2 {
+		t.Fatalf("got %d array lengths, want 2", n)
+	}
+	if merged.ArrayLength[0].Length != 10 || merged.ArrayLength[1].Length != 5 {
+		t.Errorf("overlay not appended to base: %v", merged.ArrayLength)
+	}
+	if len(merged.Strings) != 1 || len(merged.URIs) != 1 {
+		t.Errorf("got %d strings and %d uris, want 1 each",
+			len(merged.Strings), len(merged.URIs))
+	}
+
+	merged = base.Merge(&Limits{FileSize: 500})
+	if merged.FileSize != 500 {
+		t.Errorf("file size: got %d, want 500", merged.FileSize)
+	}
+	if len(base.ArrayLength) != 1 {
+		t.Error("merge modified base")
+	}
+
+	var none *Limits
+	if merged := none.Merge(overlay); len(merged.ArrayLength) != 1 {
+		t.Errorf("merge with nil base: got %v", merged.ArrayLength)
+	}
+}
+
+func TestLimitsScale(t *testing.T) {
+	limits := mustLoadLimits(t, `{
+  "file_size": 1000,
+  "arrays": [{"length": 10, "paths": ["/a"]}],
+  "strings": [{"length": 25, "paths": ["/s"]}],
+  "uris": [{"length": 1, "paths": ["/u"]}]
+}`)
+
+	scaled := limits.Scale(0.3)
+	for _, tc := range []struct {
+		name      string
+		got, want int64
+	}{
+		{"file size", scaled.FileSize, 300},
+		{"array", int64(scaled.ArrayLength[0].Length), 3},
+		{"string", int64(scaled.Strings[0].Length), 8},
+		{"uri", int64(scaled.URIs[0].Length), 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+	if limits.ArrayLength[0].Length != 10 {
+		t.Error("scale modified the original limits")
+	}
+	if got := limits.Scale(2).Strings[0].Length; got != 50 {
+		t.Errorf("scale 2: got %d, want 50", got)
+	}
+}
@@ -0,0 +1,69 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//go:embed wordlists/*.txt
+var wordLists embed.FS
+
+// loremLocale describes how to generate filler text for a language
+// other than the latin of lorem ipsum.
+type loremLocale struct {
+	// words is the vocabulary
+	words []string
+	// separator is put between words and between sentences
+	separator string
+	// fullStop ends a sentence
+	fullStop string
+}
+
+// loremLocaleSettings maps the primary language subtags of the
+// supported locales to the separator and full stop of the language.
+// The vocabulary is read from the word list with the same name.
+var loremLocaleSettings = map[string]struct{ separator, fullStop string }{
+	"de": {" ", "."},
+	"fr": {" ", "."},
+	"ja": {"", "。"},
+	"zh": {"", "。"},
+}
+
+// loremLocales holds the loaded locales so that each word list is
+// only read once.
+var loremLocales sync.Map
+
+// lookupLoremLocale returns the locale for the IETF BCP 47 language tag.
+// Only the primary language subtag is taken into account, so e.g.
+// "de-AT" is the same as "de".
+func lookupLoremLocale(tag string) (*loremLocale, error) {
+	lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	if cached, ok := loremLocales.Load(lang); ok {
+		return cached.(*loremLocale), nil
+	}
+	settings, ok := loremLocaleSettings[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q", tag)
+	}
+	data, err := wordLists.ReadFile("wordlists/" + lang + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	locale := &loremLocale{
+		words:     strings.Fields(string(data)),
+		separator: settings.separator,
+		fullStop:  settings.fullStop,
+	}
+	cached, _ := loremLocales.LoadOrStore(lang, locale)
+	return cached.(*loremLocale), nil
+}
@@ -0,0 +1,91 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"maps"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// GeneratorPool provides reusable generators for generating documents
+// concurrently. All generators of a pool share the template and the
+// limits and each has its own random number generator. It's safe to
+// use a pool from multiple goroutines.
+//
+// The pool is backed by a sync.Pool, so idle generators may be
+// discarded by the garbage collector at any time. Acquire then creates
+// a new generator, which is as expensive as creating one with
+// NewGenerator and copying the file cache. The pool therefore saves
+// allocations while generators are in steady use, but it doesn't
+// guarantee that a number of generators is kept.
+type GeneratorPool struct {
+	pool sync.Pool
+}
+
+// NewGeneratorPool creates a pool initially holding size generators.
+// Like all idle generators of the pool, they may be discarded before
+// they're acquired. The options are applied to every generator of the
+// pool after the limits. They must not make the generators share
+// mutable state, so WithRand cannot be used and each generator gets a
+// random number generator with a random seed.
+// The contents of the files used by the book types of the template are
+// read once and put into the file cache of every generator. Files that
+// cannot be read are left to the generators, which report the error
+// when they need the file.
+func NewGeneratorPool(
+	size int,
+	tmpl *Template,
+	limits *Limits,
+	opts ...GeneratorOption,
+) *GeneratorPool {
+	fileCache := make(map[string]string)
+	for _, node := range tmpl.Types {
+		book, ok := node.(*TmplBook)
+		if !ok {
+			continue
+		}
+		for _, path := range append([]string{book.Path}, book.Paths...) {
+			if path == "" {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil || !utf8.Valid(content) {
+				continue
+			}
+			fileCache[path] = string(content)
+		}
+	}
+
+	p := &GeneratorPool{}
+	p.pool.New = func() any {
+		gen := NewGenerator(tmpl, append([]GeneratorOption{WithLimits(limits)}, opts...)...)
+		gen.FileCache = maps.Clone(fileCache)
+		return gen
+	}
+	for range size {
+		p.pool.Put(p.pool.New())
+	}
+	return p
+}
+
+// Acquire returns a generator from the pool, creating a new one if
+// the pool is empty. The generator has been reset.
+func (p *GeneratorPool) Acquire() *Generator {
+	gen := p.pool.Get().(*Generator)
+	gen.Reset()
+	return gen
+}
+
+// Release returns a generator obtained with Acquire to the pool. The
+// generator must not be used afterwards.
+func (p *GeneratorPool) Release(gen *Generator) {
+	p.pool.Put(gen)
+}
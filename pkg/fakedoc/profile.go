@@ -0,0 +1,61 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// profile collects the time spent generating values for each type.
+type profile struct {
+	durations map[string]time.Duration
+	counts    map[string]int
+}
+
+// record adds a call for typename that started at start.
+func (p *profile) record(typename string, start time.Time) {
+	if p.durations == nil {
+		p.durations = make(map[string]time.Duration)
+		p.counts = make(map[string]int)
+	}
+	p.durations[typename] += time.Since(start)
+	p.counts[typename]++
+}
+
+// ProfilingReport returns a table with the number of calls and the
+// total time spent generating values for each type, sorted by total
+// time in descending order. The times include the time spent on
+// generating nested values. The report is empty unless ProfilingEnabled
+// was set while generating.
+func (gen *Generator) ProfilingReport() string {
+	p := &gen.profile
+	names := slices.SortedFunc(maps.Keys(p.durations), func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(p.durations[b], p.durations[a]),
+			cmp.Compare(a, b),
+		)
+	})
+
+	var report strings.Builder
+	w := tabwriter.NewWriter(&report, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TOTAL\tCALLS\tAVERAGE\t\tTYPE")
+	for _, name := range names {
+		total, count := p.durations[name], p.counts[name]
+		fmt.Fprintf(w, "%v\t%d\t%v\t\t%s\n",
+			total, count, total/time.Duration(count), name)
+	}
+	w.Flush()
+	return report.String()
+}
@@ -10,9 +10,13 @@ package fakedoc
 
 import (
 	"fmt"
+	"math"
 	"math/rand/v2"
+	"regexp"
 	"regexp/syntax"
+	"slices"
 	"strings"
+	"sync"
 )
 
 // Pattern generates strings based on a regular expression
@@ -21,35 +25,69 @@ type Pattern struct {
 	Pattern string
 	// The AST of the regular expression
 	ast *syntax.Regexp
+	// The compiled regular expression used for matching
+	re *regexp.Regexp
 }
 
+// defaultMaxRepeat is the number of repetitions that Sample generates
+// at most for unbounded repetitions like * and +
+const defaultMaxRepeat = 10
+
+// patternCache maps regular expressions to the corresponding compiled
+// *Pattern so that each regular expression is only compiled once, even
+// when creating several templates. Patterns are never modified after
+// compilation, so they can be shared.
+var patternCache sync.Map
+
 // CompileRegexp converts a string with a regular expression into a
 // Pattern. In addition to parsing the regular expression it also checks
 // whether the pattern only uses features that the random match
 // generator supports.
 func CompileRegexp(unparsed string) (*Pattern, error) {
-	var pat Pattern
-	if err := pat.UnmarshalText([]byte(unparsed)); err != nil {
+	if cached, ok := patternCache.Load(unparsed); ok {
+		return cached.(*Pattern), nil
+	}
+
+	ast, err := syntax.Parse(unparsed, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkAst(ast); err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(unparsed)
+	if err != nil {
 		return nil, err
 	}
-	return &pat, nil
+
+	compiled, _ := patternCache.LoadOrStore(unparsed, &Pattern{
+		Pattern: unparsed,
+		ast:     ast,
+		re:      re,
+	})
+	return compiled.(*Pattern), nil
 }
 
 // UnmarshalText implements the TextUnmarshaler interface
 func (pat *Pattern) UnmarshalText(text []byte) error {
-	unparsed := string(text)
-	ast, err := syntax.Parse(unparsed, syntax.Perl)
+	compiled, err := CompileRegexp(string(text))
 	if err != nil {
 		return err
 	}
+	*pat = *compiled
+	return nil
+}
 
-	if err = checkAst(ast); err != nil {
-		return err
-	}
+// MarshalText implements the TextMarshaler interface
+func (pat *Pattern) MarshalText() ([]byte, error) {
+	return []byte(pat.Pattern), nil
+}
 
-	pat.Pattern = unparsed
-	pat.ast = ast
-	return nil
+// Matches reports whether s contains a match of the regular expression.
+func (pat *Pattern) Matches(s string) bool {
+	return pat.re.MatchString(s)
 }
 
 // Sample generates a random match for the regular expression in Pattern
@@ -67,21 +105,126 @@ func (pat *Pattern) UnmarshalText(text []byte) error {
 //   - The go regexp library supports more features than the generator
 //     can handle so far.
 func (pat *Pattern) Sample(rand *rand.Rand) string {
-	var buf strings.Builder
-	sampler := sampler{rand: rand, buf: &buf}
+	return pat.SampleWithMaxRepeat(rand, defaultMaxRepeat)
+}
+
+// SampleWithMaxRepeat is like Sample, but limits unbounded repetitions
+// with maxRepeat instead of 10: * and + produce at most maxRepeat
+// repetitions, {n,} at most n+maxRepeat.
+func (pat *Pattern) SampleWithMaxRepeat(rand *rand.Rand, maxRepeat int) string {
+	sampler := newSampler(rand, maxRepeat)
 	sampler.sampleAstNode(pat.ast)
-	return buf.String()
+	return sampler.buf.String()
+}
+
+// MinLength returns the minimum length in runes of the strings
+// generated by Sample.
+func (pat *Pattern) MinLength() int {
+	minLength, _ := astLength(pat.ast, defaultMaxRepeat)
+	return minLength
+}
+
+// MaxLength returns the maximum length in runes of the strings
+// generated by Sample. Unbounded repetitions like * and + are limited
+// in the same way as in Sample, so the result is finite even if the
+// regular expression matches arbitrarily long strings.
+func (pat *Pattern) MaxLength() int {
+	return pat.maxLength(defaultMaxRepeat)
+}
+
+// maxLength returns the maximum length in runes of the strings
+// generated by SampleWithMaxRepeat with maxRepeat.
+func (pat *Pattern) maxLength(maxRepeat int) int {
+	_, maxLength := astLength(pat.ast, maxRepeat)
+	return maxLength
+}
+
+// astLength returns the minimum and maximum length in runes of the
+// strings that a sampler with the given maxRepeat generates for ast.
+func astLength(ast *syntax.Regexp, maxRepeat int) (int, int) {
+	switch ast.Op {
+	case syntax.OpLiteral:
+		return len(ast.Rune), len(ast.Rune)
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpCharClass:
+		return 1, 1
+	case syntax.OpCapture:
+		return astLength(ast.Sub[0], maxRepeat)
+	case syntax.OpConcat:
+		minLength, maxLength := 0, 0
+		for _, sub := range ast.Sub {
+			low, high := astLength(sub, maxRepeat)
+			minLength += low
+			maxLength += high
+		}
+		return minLength, maxLength
+	case syntax.OpAlternate:
+		minLength, maxLength := math.MaxInt, 0
+		for _, sub := range ast.Sub {
+			if sub == nil {
+				continue
+			}
+			low, high := astLength(sub, maxRepeat)
+			minLength = min(minLength, low)
+			maxLength = max(maxLength, high)
+		}
+		if minLength > maxLength {
+			return 0, 0
+		}
+		return minLength, maxLength
+	case syntax.OpQuest:
+		_, high := astLength(ast.Sub[0], maxRepeat)
+		return 0, high
+	case syntax.OpStar:
+		_, high := astLength(ast.Sub[0], maxRepeat)
+		return 0, maxRepeat * high
+	case syntax.OpPlus:
+		low, high := astLength(ast.Sub[0], maxRepeat)
+		return low, maxRepeat * high
+	case syntax.OpRepeat:
+		low, high := astLength(ast.Sub[0], maxRepeat)
+		maxCount := ast.Max
+		if maxCount < 0 {
+			maxCount = ast.Min + maxRepeat
+		}
+		return ast.Min * low, maxCount * high
+	default:
+		// empty matches and assertions like ^ and $
+		return 0, 0
+	}
 }
 
 type sampler struct {
 	rand *rand.Rand
 	buf  *strings.Builder
+	// maxRepeat is the maximum number of repetitions beyond the
+	// minimum for unbounded repetitions
+	maxRepeat int
+}
+
+// newSampler creates a sampler. If maxRepeat is not positive, the
+// default of 10 is used.
+func newSampler(rand *rand.Rand, maxRepeat int) *sampler {
+	if maxRepeat <= 0 {
+		maxRepeat = defaultMaxRepeat
+	}
+	return &sampler{rand: rand, buf: &strings.Builder{}, maxRepeat: maxRepeat}
 }
 
 func (s *sampler) sampleAstNode(ast *syntax.Regexp) {
 	switch ast.Op {
 	case syntax.OpAlternate:
-		s.sampleAstNode(choose(s.rand, ast.Sub))
+		subs := ast.Sub
+		if slices.Contains(subs, nil) {
+			subs = slices.DeleteFunc(slices.Clone(subs), func(sub *syntax.Regexp) bool {
+				return sub == nil
+			})
+		}
+		if len(subs) > 0 {
+			s.sampleAstNode(choose(s.rand, subs))
+		}
+	case syntax.OpAnyChar:
+		// any valid code point, i.e. all except the surrogates
+		s.buf.WriteRune(s.chooseCharClass([]rune{0, 0xD7FF, 0xE000, 0x10FFFF}))
 	case syntax.OpAnyCharNotNL:
 		// FIXME: choose better character range
 		s.buf.WriteRune(s.chooseCharClass([]rune{' ', '\x7e'}))
@@ -104,7 +247,7 @@ func (s *sampler) sampleAstNode(ast *syntax.Regexp) {
 	case syntax.OpLiteral:
 		s.buf.WriteString(string(ast.Rune))
 	case syntax.OpPlus:
-		s.repeat(ast.Sub[0], s.chooseRange(1, 10))
+		s.repeat(ast.Sub[0], s.chooseRange(1, s.maxRepeat))
 	case syntax.OpQuest:
 		if s.rand.IntN(2) > 0 {
 			s.sampleAstNode(ast.Sub[0])
@@ -112,7 +255,7 @@ func (s *sampler) sampleAstNode(ast *syntax.Regexp) {
 	case syntax.OpRepeat:
 		s.repeat(ast.Sub[0], s.chooseRange(ast.Min, ast.Max))
 	case syntax.OpStar:
-		s.repeat(ast.Sub[0], s.chooseRange(0, 10))
+		s.repeat(ast.Sub[0], s.chooseRange(0, s.maxRepeat))
 	default:
 		// We should never get here. Unsupported operations should have
 		// been found by checkAst
@@ -149,7 +292,7 @@ func (s *sampler) chooseRange(low, high int) int {
 	if high < 0 {
 		// no upper bound given in the regex. Choose an fixed arbitray
 		// upper bound anyway to avoid excessively long strings
-		high = low + 10
+		high = low + s.maxRepeat
 	}
 	length := high - low
 	if length > 0 {
@@ -160,6 +303,7 @@ func (s *sampler) chooseRange(low, high int) int {
 
 var supportedOps = map[syntax.Op]any{
 	syntax.OpAlternate:    nil,
+	syntax.OpAnyChar:      nil,
 	syntax.OpAnyCharNotNL: nil,
 	syntax.OpBeginText:    nil,
 	syntax.OpCapture:      nil,
@@ -197,10 +341,18 @@ func checkAstNode(ast *syntax.Regexp, ops *map[syntax.Op]any) error {
 	switch ast.Op {
 	case syntax.OpAlternate, syntax.OpConcat:
 		for _, sub := range ast.Sub {
-			checkAstNode(sub, ops)
+			if sub == nil {
+				continue
+			}
+			if err := checkAstNode(sub, ops); err != nil {
+				return err
+			}
 		}
 	case syntax.OpCapture, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat, syntax.OpStar:
-		checkAstNode(ast.Sub[0], ops)
+		if len(ast.Sub) == 0 {
+			return fmt.Errorf("%v without operand", ast.Op)
+		}
+		return checkAstNode(ast.Sub[0], ops)
 	case syntax.OpCharClass:
 		if len(ast.Rune) == 0 {
 			return fmt.Errorf("character class without valid matches")
@@ -9,10 +9,16 @@
 package fakedoc
 
 import (
+	"bytes"
 	"math/rand/v2"
 	"regexp"
 	"regexp/syntax"
+	"slices"
+	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
 )
 
 func TestPatternGeneratesMatchingStrings(t *testing.T) {
@@ -61,3 +67,186 @@ func TestCompileRegexpFeatureCheck(t *testing.T) {
 		}
 	}
 }
+
+func TestPatternMatches(t *testing.T) {
+	pattern, err := CompileRegexp("^(test|dummy)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		s       string
+		matches bool
+	}{
+		{"test document", true},
+		{"dummy", true},
+		{"a test", false},
+		{"", false},
+	} {
+		if got := pattern.Matches(test.s); got != test.matches {
+			t.Errorf("Matches(%q) = %t, expected %t", test.s, got, test.matches)
+		}
+	}
+}
+
+func TestPatternAnyChar(t *testing.T) {
+	pattern, err := CompileRegexp("(?s).{5}")
+	if err != nil {
+		t.Fatalf("CompileRegexp failed: %v", err)
+	}
+	rand := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		s := pattern.Sample(rand)
+		if n := utf8.RuneCountInString(s); n != 5 || !utf8.ValidString(s) {
+			t.Fatalf("%q has %d runes, expected 5 valid runes", s, n)
+		}
+		if !pattern.Matches(s) {
+			t.Fatalf("%q does not match the pattern", s)
+		}
+	}
+}
+
+func TestPatternLength(t *testing.T) {
+	for _, test := range []struct {
+		re       string
+		min, max int
+	}{
+		{"a{3,7}", 3, 7},
+		{"(ab|cde)", 2, 3},
+		{"x*", 0, 10},
+		{"[0-9]{2}", 2, 2},
+		{"^x+y?$", 1, 11},
+	} {
+		pattern, err := CompileRegexp(test.re)
+		if err != nil {
+			t.Fatalf("CompileRegexp(%q) failed: %v", test.re, err)
+		}
+		if got := pattern.MinLength(); got != test.min {
+			t.Errorf("%q: MinLength() = %d, expected %d", test.re, got, test.min)
+		}
+		if got := pattern.MaxLength(); got != test.max {
+			t.Errorf("%q: MaxLength() = %d, expected %d", test.re, got, test.max)
+		}
+	}
+}
+
+func TestPatternLengthBounds(t *testing.T) {
+	pattern, err := CompileRegexp("[a-z]{1,20}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templ := &Template{
+		Root: "s",
+		Types: map[string]TmplNode{
+			"s": &TmplString{MinLength: 10, MaxLength: -1, Pattern: pattern},
+		},
+	}
+	gen := NewGenerator(templ, WithRand(rand.New(rand.NewPCG(1, 2))))
+	gen.MaxItemAttempts = 100
+	for range 100 {
+		if s := MustGenerate(gen).(string); len(s) < 10 {
+			t.Fatalf("%q is shorter than the minimum length 10", s)
+		}
+	}
+}
+
+func TestPatternEmptyAlternatives(t *testing.T) {
+	rand := rand.New(rand.NewPCG(1, 2))
+	for _, test := range []struct {
+		re      string
+		allowed []string
+	}{
+		{"^(a|)$", []string{"a", ""}},
+		{"^(|a)$", []string{"a", ""}},
+		{"^(|)$", []string{""}},
+		{"^(a||b)$", []string{"a", "b", ""}},
+	} {
+		pattern, err := CompileRegexp(test.re)
+		if err != nil {
+			t.Fatalf("CompileRegexp(%q) failed: %v", test.re, err)
+		}
+		for range 20 {
+			s := pattern.Sample(rand)
+			if !slices.Contains(test.allowed, s) || !pattern.Matches(s) {
+				t.Errorf("%q: unexpected string %q", test.re, s)
+			}
+		}
+	}
+
+	// An alternation with a nil alternative as it might be produced
+	// when manipulating the syntax tree.
+	ast := &syntax.Regexp{
+		Op:  syntax.OpAlternate,
+		Sub: []*syntax.Regexp{nil, {Op: syntax.OpLiteral, Rune: []rune("a")}},
+	}
+	if err := checkAst(ast); err != nil {
+		t.Fatalf("checkAst failed: %v", err)
+	}
+	pattern := &Pattern{ast: ast}
+	for range 20 {
+		if s := pattern.Sample(rand); s != "a" {
+			t.Errorf("unexpected string %q", s)
+		}
+	}
+}
+
+func TestPatternMaxRepeat(t *testing.T) {
+	templ, err := ParseTemplate(`
+root = "s"
+
+[types.s]
+type = "string"
+pattern = "^[a-z]+$"
+maxrepeat = 50
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	gen := NewGenerator(templ, WithRand(rand.New(rand.NewPCG(1, 2))))
+	longest := 0
+	for range 100 {
+		s := MustGenerate(gen).(string)
+		if len(s) < 1 || len(s) > 50 {
+			t.Fatalf("%q has a length outside of 1..50", s)
+		}
+		longest = max(longest, len(s))
+	}
+	if longest <= 10 {
+		t.Errorf("longest string has %d characters, expected more than 10", longest)
+	}
+	if n := templ.Types["s"].(*TmplString).Pattern.maxLength(50); n != 50 {
+		t.Errorf("maxLength(50) = %d, expected 50", n)
+	}
+}
+
+func TestPatternMarshalText(t *testing.T) {
+	pattern, err := CompileRegexp("^[A-Z]{3}-[0-9]{2,4}$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := &TmplString{MinLength: -1, MaxLength: -1, Pattern: pattern}
+
+	// Encoding the node directly uses MarshalText.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(str); err != nil {
+		t.Fatalf("encoding TmplString failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `pattern = "^[A-Z]{3}-[0-9]{2,4}$"`) {
+		t.Errorf("pattern not encoded as string:\n%s", buf.String())
+	}
+
+	templ := &Template{Root: "s", Types: map[string]TmplNode{"s": str}}
+	buf.Reset()
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	gen := NewGenerator(loaded, WithRand(rand.New(rand.NewPCG(1, 2))))
+	for range 20 {
+		if s := MustGenerate(gen).(string); !pattern.Matches(s) {
+			t.Fatalf("%q does not match %q", s, pattern.Pattern)
+		}
+	}
+}
@@ -6,13 +6,17 @@
 // SPDX-FileCopyrightText: 2021, 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
 // Software-Engineering: 2021, 2024 Intevation GmbH <https://intevation.de>
 
-// Package fakedoc contains code to generate random fake CSAF files
 package fakedoc
 
 import (
 	"bytes"
 	_ "embed" // Used for embedding.
+	"encoding/json"
 	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -69,12 +73,16 @@ func loadURL(s string) (io.ReadCloser, error) {
 	}
 }
 
-func (cs *compiledSchema) compile() {
+func newCompiler() *jsonschema.Compiler {
 	c := jsonschema.NewCompiler()
 	c.AssertFormat = true
 	c.ExtractAnnotations = true
 	c.LoadURL = loadURL
-	cs.compiled, cs.err = c.Compile(cs.url)
+	return c
+}
+
+func (cs *compiledSchema) compile() {
+	cs.compiled, cs.err = newCompiler().Compile(cs.url)
 }
 
 func (cs *compiledSchema) getSchema() (*jsonschema.Schema, error) {
@@ -87,6 +95,124 @@ func CompileSchema() (*jsonschema.Schema, error) {
 	return compiledCSAFSchema.getSchema()
 }
 
+// CompileSchemaFromBytes compiles the JSON schema contained in data.
+// The baseURL is used as the location of the schema and for resolving
+// relative references. References to the schemas embedded in fakedoc
+// are resolved without network access.
+func CompileSchemaFromBytes(data []byte, baseURL string) (*jsonschema.Schema, error) {
+	c := newCompiler()
+	if err := c.AddResource(baseURL, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return c.Compile(baseURL)
+}
+
+// SchemaVersion returns the version of the CSAF specification the
+// embedded CSAF JSON schema is for, e.g. "2.0".
+func SchemaVersion() string {
+	return csafSchemaVersion()
+}
+
+// CVSSSchemaVersion returns the CVSS version of the embedded CVSS JSON
+// schema of the given flavor, which can be "2.0", "3.0" or "3.1". For
+// other flavors it returns the empty string.
+func CVSSSchemaVersion(flavor string) string {
+	var data []byte
+	switch flavor {
+	case "2.0":
+		data = cvss20
+	case "3.0":
+		data = cvss30
+	case "3.1":
+		data = cvss31
+	default:
+		return ""
+	}
+	var schema struct {
+		Properties struct {
+			Version versionSchema `json:"version"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return ""
+	}
+	return schema.Properties.Version.value()
+}
+
+// csafSchemaVersion extracts the CSAF version from the embedded CSAF
+// JSON schema. It's only done once.
+var csafSchemaVersion = sync.OnceValue(func() string {
+	var schema struct {
+		Properties struct {
+			Document struct {
+				Properties struct {
+					CSAFVersion versionSchema `json:"csaf_version"`
+				} `json:"properties"`
+			} `json:"document"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(csafSchema, &schema); err != nil {
+		return ""
+	}
+	return schema.Properties.Document.Properties.CSAFVersion.value()
+})
+
+// versionSchema is the part of a JSON schema of a version property
+// that contains the allowed version.
+type versionSchema struct {
+	Enum []string `json:"enum"`
+}
+
+// value returns the only allowed version or the empty string if it's
+// not unique.
+func (vs versionSchema) value() string {
+	if len(vs.Enum) != 1 {
+		return ""
+	}
+	return vs.Enum[0]
+}
+
+// LoadSchemaFromFile compiles the JSON schema in the file at path. The
+// other JSON files in the same directory are made available to the
+// compiler so that the schema can refer to them with relative
+// references like "./common.json".
+func LoadSchemaFromFile(path string) (*jsonschema.Schema, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fileURL := func(path string) string {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+
+	c := newCompiler()
+	siblings, err := filepath.Glob(filepath.Join(filepath.Dir(abs), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, sibling := range slices.DeleteFunc(siblings, func(p string) bool {
+		return p == abs
+	}) {
+		// Siblings that cannot be used are skipped. They're likely
+		// not referenced by the schema anyway and if they are,
+		// compiling the schema fails with a more useful error.
+		data, err := os.ReadFile(sibling)
+		if err != nil {
+			continue
+		}
+		_ = c.AddResource(fileURL(sibling), bytes.NewReader(data))
+	}
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.AddResource(fileURL(abs), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return c.Compile(fileURL(abs))
+}
+
 // ShortLocation returns a shortened version of the schema's Location.
 // In the shortened form the URL prefix is replaced with a much shorter
 // prefix. The shortened form is still unique enough to identify
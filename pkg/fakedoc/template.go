@@ -9,12 +9,21 @@
 package fakedoc
 
 import (
+	"bytes"
 	"cmp"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"math/big"
+	"os"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/BurntSushi/toml"
 	"github.com/santhosh-tekuri/jsonschema/v5"
@@ -23,6 +32,10 @@ import (
 const (
 	uriRegexp = `(https?)://(example\.(com|org|net)|[a-zA-Z][a-zA-Z0-9]{10}\.example(/[a-zA-Z0-9.-]{1,10}){3})`
 
+	// cveRegexp is the pattern of CVE IDs used by the CSAF schema.
+	// Strings with this pattern are generated with TmplCVE.
+	cveRegexp = `^CVE-[0-9]{4}-[0-9]{4,}$`
+
 	// constants for the 'synthetic' template type for the product ID
 	// generator
 	productIDTypeName  = "fakedoc:product_id_generator"
@@ -38,10 +51,19 @@ type Template struct {
 
 	// The type of the root node
 	Root string
+
+	// MemoizeTypes contains the names of types for which a value is
+	// only generated once per document. See Generator.MemoizeTypes.
+	MemoizeTypes []string
+
+	// schemaErrors collects the errors of fromSchema if not nil, so
+	// that the conversion can continue after an error.
+	schemaErrors *[]error
 }
 
-// Write writes the template in TOML format
-func (t *Template) Write(out io.Writer) error {
+// asMap returns a map describing the template, used for both the TOML
+// and the JSON format.
+func (t *Template) asMap() map[string]any {
 	types := make(map[string]map[string]any)
 	for name, child := range t.Types {
 		types[name] = child.AsMap()
@@ -50,14 +72,302 @@ func (t *Template) Write(out io.Writer) error {
 		"types": types,
 		"root":  t.Root,
 	}
-	return toml.NewEncoder(out).Encode(m)
+	if len(t.MemoizeTypes) > 0 {
+		m["memoize"] = map[string]any{"types": t.MemoizeTypes}
+	}
+	return m
+}
+
+// Write writes the template in TOML format
+func (t *Template) Write(out io.Writer) error {
+	return toml.NewEncoder(out).Encode(t.asMap())
+}
+
+// WriteJSON writes the template in JSON format. The JSON has the same
+// structure as the TOML written by Write.
+func (t *Template) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tomlToJSON(t.asMap()))
+}
+
+// tomlToJSON returns a copy of v in which the floats are json.Numbers
+// that always have a fraction or an exponent, so that jsonToTOML can
+// tell them apart from integers.
+func tomlToJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = tomlToJSON(value)
+		}
+		return m
+	case map[string]map[string]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = tomlToJSON(value)
+		}
+		return m
+	case []map[string]any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = tomlToJSON(value)
+		}
+		return s
+	case []any:
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = tomlToJSON(value)
+		}
+		return s
+	case float64:
+		num := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(num, ".eE") {
+			num += ".0"
+		}
+		return json.Number(num)
+	default:
+		return v
+	}
 }
 
-// Merge adds the types of another template.
+// Merge adds the types of another template. It's the same as
+// MergeDeep, but ignores the errors. The property type overrides and
+// property filters reported by MergeDeep are dropped, everything else
+// is merged anyway.
 func (t *Template) Merge(other *Template) {
-	for name, ty := range other.Types {
+	_ = t.MergeDeep(other)
+}
+
+// MergeDeep adds the types of another template. Types of the other
+// template replace the types with the same name, except for objects
+// replacing objects, whose properties are merged: Properties of the
+// other object replace the properties with the same name and all other
+// properties are appended. All other attributes are taken from the
+// other object and its property type overrides are applied to the
+// merged properties. The other template is not modified.
+//
+// Property type overrides for unknown properties and objects that
+// modify properties without replacing an object are reported as
+// errors. The rest of the other template is merged anyway.
+func (t *Template) MergeDeep(other *Template) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(other.Types)) {
+		ty := other.Types[name]
+		obj, ok := ty.(*TmplObject)
+		base, baseOK := t.Types[name].(*TmplObject)
+		switch {
+		case ok && baseOK:
+			merged := *obj
+			merged.Properties = mergeProperties(base.Properties, obj.Properties)
+			if err := merged.applyPropertyTypes(); err != nil {
+				errs = append(errs, fmt.Errorf("type %s: %w", name, err))
+			}
+			ty = &merged
+		case ok && len(obj.Properties) == 0 &&
+			(len(obj.PropertyTypes) > 0 || len(obj.PropertyFilter) > 0 ||
+				len(obj.ExcludeProperties) > 0):
+			errs = append(errs, fmt.Errorf("type %s: no properties to modify", name))
+		}
 		t.Types[name] = ty
 	}
+	t.mergeMemoizeTypes(other)
+	return errors.Join(errs...)
+}
+
+// mergeMemoizeTypes adds the memoized types of another template.
+func (t *Template) mergeMemoizeTypes(other *Template) {
+	for _, name := range other.MemoizeTypes {
+		if !slices.Contains(t.MemoizeTypes, name) {
+			t.MemoizeTypes = append(t.MemoizeTypes, name)
+		}
+	}
+}
+
+// ErrFilteredRequired is wrapped by the errors that Validate reports for
+// required properties in the PropertyFilter or ExcludeProperties of an
+// object. The documents
+// generated from such templates are usually invalid, which may be
+// intended, so generators don't reject these templates.
+var ErrFilteredRequired = errors.New("required property is filtered")
+
+// Validate checks that all types referenced by the template are
+// defined and that the namespaces of all ref types have IDs generated
+// by an id type. It also reports the required properties that are
+// filtered with errors wrapping ErrFilteredRequired. It returns one
+// error for each problem found.
+func (t *Template) Validate() []error {
+	var errs []error
+	if _, ok := t.Types[t.Root]; !ok {
+		errs = append(errs, fmt.Errorf("root type %s is not defined", t.Root))
+	}
+
+	idNamespaces := make(map[string]bool)
+	for _, node := range t.Types {
+		if id, ok := node.(*TmplID); ok {
+			idNamespaces[id.Namespace] = true
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(t.Types)) {
+		check := func(what, typename string) {
+			if _, ok := t.Types[typename]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"type %s: %s refers to undefined type %s",
+					name, what, typename,
+				))
+			}
+		}
+		checkOptional := func(what, typename string) {
+			if typename != "" {
+				check(what, typename)
+			}
+		}
+		switch node := t.Types[name].(type) {
+		case *TmplObject:
+			for _, prop := range node.Properties {
+				check("property "+prop.Name, prop.Type)
+				if prop.Required && node.excluded(prop.Name) {
+					errs = append(errs, fmt.Errorf(
+						"type %s: %w: %s", name, ErrFilteredRequired, prop.Name,
+					))
+				}
+			}
+			for _, subtype := range node.AbstractSubtypes {
+				check("abstract subtype", subtype)
+			}
+			checkOptional("additionalproperties", node.AdditionalProperties)
+		case *TmplArray:
+			check("items", node.Items)
+			checkOptional("contains", node.Contains)
+			checkOptional("padwithfallback", node.PadWithFallback)
+		case *TmplOneOf:
+			for _, alternative := range node.OneOf {
+				check("oneof", alternative)
+			}
+		case *TmplWeightedOneOf:
+			for _, choice := range node.Choices {
+				check("choice", choice.Type)
+			}
+		case *TmplConditional:
+			check("condition", node.Condition)
+			for _, typename := range node.Then {
+				check("then", typename)
+			}
+			for _, typename := range node.Else {
+				check("else", typename)
+			}
+		case *TmplRef:
+			if !idNamespaces[node.Namespace] {
+				errs = append(errs, fmt.Errorf(
+					"type %s: no id type for namespace %s",
+					name, node.Namespace,
+				))
+			}
+		}
+	}
+	return errs
+}
+
+// mergeProperties returns copies of the base properties in which
+// properties with the same name as one of the overrides are replaced by
+// the override. The other overrides are appended.
+func mergeProperties(base, overrides []*Property) []*Property {
+	merged := make([]*Property, 0, len(base)+len(overrides))
+	for _, p := range base {
+		cp := *p
+		merged = append(merged, &cp)
+	}
+	for _, p := range overrides {
+		cp := *p
+		idx := slices.IndexFunc(merged, func(q *Property) bool {
+			return q.Name == p.Name
+		})
+		if idx >= 0 {
+			merged[idx] = &cp
+		} else {
+			merged = append(merged, &cp)
+		}
+	}
+	return merged
+}
+
+// TypeInfo describes a type of a template
+type TypeInfo struct {
+	// Name is the name of the type
+	Name string
+	// Kind is the kind of the type as used in the type attribute of
+	// template files, e.g. "object" or "string"
+	Kind string
+}
+
+// ListTypes returns the names and kinds of all types of the template
+// sorted by name.
+func (t *Template) ListTypes() []TypeInfo {
+	infos := make([]TypeInfo, 0, len(t.Types))
+	for _, name := range slices.Sorted(maps.Keys(t.Types)) {
+		kind, _ := t.Types[name].AsMap()["type"].(string)
+		infos = append(infos, TypeInfo{Name: name, Kind: kind})
+	}
+	return infos
+}
+
+// Dependencies describes the namespaces of the IDs that are generated
+// and referenced by a type and the types it contains.
+type Dependencies struct {
+	// Defines contains the namespaces of the IDs that may be generated
+	Defines []string
+
+	// References contains the namespaces of the IDs that may be
+	// referenced
+	References []string
+}
+
+// Dependencies returns the namespaces in which the type and the types
+// it contains generate and reference IDs.
+func (t *Template) Dependencies(typename string) Dependencies {
+	var deps Dependencies
+	visited := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		if name == "" || visited[name] {
+			return
+		}
+		visited[name] = true
+		var children []string
+		switch node := t.Types[name].(type) {
+		case *TmplObject:
+			for _, prop := range node.Properties {
+				children = append(children, prop.Type)
+			}
+			children = append(children, node.AbstractSubtypes...)
+			children = append(children, node.AdditionalProperties)
+		case *TmplArray:
+			children = []string{node.Items, node.Contains, node.PadWithFallback}
+		case *TmplOneOf:
+			children = node.OneOf
+		case *TmplWeightedOneOf:
+			for _, choice := range node.Choices {
+				children = append(children, choice.Type)
+			}
+		case *TmplConditional:
+			children = append([]string{node.Condition}, node.Then...)
+			children = append(children, node.Else...)
+		case *TmplID:
+			if !slices.Contains(deps.Defines, node.Namespace) {
+				deps.Defines = append(deps.Defines, node.Namespace)
+			}
+		case *TmplRef:
+			if !slices.Contains(deps.References, node.Namespace) {
+				deps.References = append(deps.References, node.Namespace)
+			}
+		}
+		for _, child := range children {
+			visit(child)
+		}
+	}
+	visit(typename)
+	return deps
 }
 
 // FromToml initializes a TmplNode from toml.MetaData and a
@@ -98,21 +408,42 @@ var nodeFactories = map[string]func() TmplNode{
 	},
 	"array": func() TmplNode {
 		return &TmplArray{
-			MinItems: -1,
-			MaxItems: -1,
+			MinItems:           -1,
+			MaxItems:           -1,
+			LengthDistribution: LengthUniform,
 		}
 	},
 	"object": func() TmplNode {
 		return &TmplObject{
 			MinProperties: -1,
 			MaxProperties: -1,
+			MaxAdditional: 3,
 		}
 	},
 	"id":        func() TmplNode { return new(TmplID) },
 	"ref":       func() TmplNode { return new(TmplRef) },
 	"number":    func() TmplNode { return new(TmplNumber) },
+	"integer":   func() TmplNode { return new(TmplInteger) },
 	"date-time": func() TmplNode { return new(TmplDateTime) },
-	"oneof":     func() TmplNode { return new(TmplOneOf) },
+	"date":      func() TmplNode { return new(TmplDate) },
+	"oneof": func() TmplNode {
+		return &TmplOneOf{MinBranches: 1, MaxBranches: 1}
+	},
+	"varref":         func() TmplNode { return new(TmplVarRef) },
+	"weighted_oneof": func() TmplNode { return new(TmplWeightedOneOf) },
+	"conditional": func() TmplNode {
+		return &TmplConditional{
+			CondProbability: 0.5,
+		}
+	},
+	"bool": func() TmplNode {
+		return &TmplBool{Probability: 0.5}
+	},
+	"null":  func() TmplNode { return new(TmplNull) },
+	"const": func() TmplNode { return new(TmplConst) },
+	"ipv4":  func() TmplNode { return new(TmplIPv4) },
+	"cve":   func() TmplNode { return newTmplCVE() },
+	"email": func() TmplNode { return new(TmplEmail) },
 }
 
 // Property describes how to generate one of an object's properties
@@ -122,6 +453,30 @@ type Property struct {
 	Required bool   `toml:"required"`
 }
 
+// ConditionalGroup describes properties of an object that are only
+// required if other properties have specific values, as expressed by
+// if/then with const values in a JSON schema.
+type ConditionalGroup struct {
+	// WhenPropertyIs maps property names to the values they must have
+	// for the condition to be met.
+	WhenPropertyIs map[string]string `toml:"whenpropertyis"`
+
+	// ThenRequired contains the names of the properties that are
+	// required if the condition is met.
+	ThenRequired []string `toml:"thenrequired"`
+}
+
+// applies returns whether all conditions of the group are met by the
+// given properties.
+func (g *ConditionalGroup) applies(properties map[string]any) bool {
+	for name, want := range g.WhenPropertyIs {
+		if value, ok := properties[name].(string); !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
 // TmplObject describes a JSON object
 type TmplObject struct {
 	// Properties describes how to generate the object's properties.
@@ -134,6 +489,82 @@ type TmplObject struct {
 	// MaxProperties is the maximum number of properties that the
 	// generated object must have. -1 means no limit.
 	MaxProperties int `toml:"maxproperties"`
+
+	// PropertyFilter contains the names of properties that are never
+	// generated, even if they're required.
+	PropertyFilter []string `toml:"propertyfilter"`
+
+	// ExcludeProperties contains the names of properties that are
+	// removed from the object entirely. Unlike PropertyFilter it's meant
+	// for suppressing properties of a base template in a template
+	// merged into it. Excluding a required property is reported by
+	// Validate.
+	ExcludeProperties []string `toml:"excludeproperties"`
+
+	// RequiredOverrides contains the names of properties that are
+	// treated as required regardless of their Required flag.
+	RequiredOverrides []string `toml:"requiredoverrides"`
+
+	// Stub indicates that close to the maximum depth only the required
+	// properties and as many optional properties as needed to reach
+	// MinProperties are generated. See Generator.StubDepthThreshold.
+	Stub bool `toml:"stub"`
+
+	// Singleton indicates that the object is generated at most once per
+	// document. All occurrences of the type in the document share the
+	// first generated value.
+	Singleton bool `toml:"singleton"`
+
+	// GenerationOrder contains the names of properties that are
+	// generated before all other properties, in the given order. The
+	// optional properties in this list are always generated, except
+	// for stub objects. This helps with references in required
+	// properties to IDs defined in optional properties.
+	GenerationOrder []string `toml:"generationorder"`
+
+	// PropertyGroups contains groups of names of optional properties
+	// that are either all generated or not at all. In TOML each group
+	// is a table with a properties array.
+	PropertyGroups [][]string `toml:"-"`
+
+	// AbstractSubtypes contains the names of the types implementing an
+	// abstract object type. If not empty, the object's own properties
+	// are ignored and the value is generated from one of these types,
+	// chosen randomly.
+	AbstractSubtypes []string `toml:"abstractsubtypes"`
+
+	// PropertyTypes maps property names to type names. When the
+	// template is loaded, the types of the listed properties are
+	// replaced accordingly, leaving all other properties unchanged.
+	PropertyTypes map[string]string `toml:"propertytypes"`
+
+	// SkipProbability is the probability with which each optional
+	// property is skipped before the optional properties are chosen.
+	// 0 never skips a property, 1 skips all of them. Properties needed
+	// to reach MinProperties are never skipped.
+	SkipProbability float64 `toml:"skipprobability"`
+
+	// ConditionalRequired contains groups of properties that are
+	// generated if the properties generated before them have specific
+	// values. The conditions are checked after the required properties
+	// have been generated.
+	ConditionalRequired []ConditionalGroup `toml:"conditionalrequired"`
+
+	// AdditionalProperties is the name of the type of the values of
+	// additional properties with random names, as allowed by the
+	// additionalProperties keyword of JSON schema. Optional.
+	AdditionalProperties string `toml:"additionalproperties"`
+
+	// MaxAdditional is the maximum number of additional properties.
+	// Default is 3.
+	MaxAdditional int `toml:"maxadditional"`
+}
+
+// excluded returns whether the property is never generated because of
+// PropertyFilter or ExcludeProperties.
+func (t *TmplObject) excluded(name string) bool {
+	return slices.Contains(t.PropertyFilter, name) ||
+		slices.Contains(t.ExcludeProperties, name)
 }
 
 // AsMap implements TmplNode
@@ -160,14 +591,127 @@ func (t *TmplObject) AsMap() map[string]any {
 	if t.MaxProperties != -1 {
 		m["maxproperties"] = t.MaxProperties
 	}
+	if len(t.PropertyFilter) > 0 {
+		m["propertyfilter"] = t.PropertyFilter
+	}
+	if len(t.ExcludeProperties) > 0 {
+		m["excludeproperties"] = t.ExcludeProperties
+	}
+	if len(t.RequiredOverrides) > 0 {
+		m["requiredoverrides"] = t.RequiredOverrides
+	}
+	if t.Stub {
+		m["stub"] = t.Stub
+	}
+	if t.Singleton {
+		m["singleton"] = t.Singleton
+	}
+	if len(t.GenerationOrder) > 0 {
+		m["generationorder"] = t.GenerationOrder
+	}
+	if len(t.PropertyGroups) > 0 {
+		groups := make([]map[string]any, len(t.PropertyGroups))
+		for i, group := range t.PropertyGroups {
+			groups[i] = map[string]any{"properties": group}
+		}
+		m["propertygroups"] = groups
+	}
+	if len(t.AbstractSubtypes) > 0 {
+		m["abstractsubtypes"] = t.AbstractSubtypes
+	}
+	if len(t.PropertyTypes) > 0 {
+		m["propertytypes"] = t.PropertyTypes
+	}
+	if t.SkipProbability != 0 {
+		m["skipprobability"] = t.SkipProbability
+	}
+	if t.AdditionalProperties != "" {
+		m["additionalproperties"] = t.AdditionalProperties
+		if t.MaxAdditional != 3 {
+			m["maxadditional"] = t.MaxAdditional
+		}
+	}
+	if len(t.ConditionalRequired) > 0 {
+		groups := make([]map[string]any, len(t.ConditionalRequired))
+		for i, group := range t.ConditionalRequired {
+			groups[i] = map[string]any{
+				"whenpropertyis": group.WhenPropertyIs,
+				"thenrequired":   group.ThenRequired,
+			}
+		}
+		m["conditionalrequired"] = groups
+	}
 	return m
 }
 
+// applyPropertyTypes sets the types of the properties listed in
+// PropertyTypes.
+func (t *TmplObject) applyPropertyTypes() error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(t.PropertyTypes)) {
+		idx := slices.IndexFunc(t.Properties, func(p *Property) bool {
+			return p.Name == name
+		})
+		if idx < 0 {
+			errs = append(errs, fmt.Errorf("propertytypes: no property %s", name))
+			continue
+		}
+		t.Properties[idx].Type = t.PropertyTypes[name]
+	}
+	return errors.Join(errs...)
+}
+
 // FromToml implements FromToml
 func (t *TmplObject) FromToml(md toml.MetaData, primType toml.Primitive) error {
 	if err := md.PrimitiveDecode(primType, t); err != nil {
 		return err
 	}
+	var groups struct {
+		PropertyGroups []struct {
+			Properties []string `toml:"properties"`
+		} `toml:"propertygroups"`
+	}
+	if err := md.PrimitiveDecode(primType, &groups); err != nil {
+		return err
+	}
+	t.PropertyGroups = nil
+	for _, group := range groups.PropertyGroups {
+		t.PropertyGroups = append(t.PropertyGroups, group.Properties)
+	}
+
+	if t.MaxAdditional < 0 {
+		return fmt.Errorf("negative maxadditional %d", t.MaxAdditional)
+	}
+
+	if t.SkipProbability < 0 || t.SkipProbability > 1 {
+		return fmt.Errorf(
+			"skipprobability %g not in range 0 to 1", t.SkipProbability)
+	}
+
+	// Without properties the overrides are applied when the template is
+	// merged into one that defines them.
+	if len(t.Properties) > 0 {
+		if err := t.applyPropertyTypes(); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range t.ConditionalRequired {
+		for _, name := range group.ThenRequired {
+			if !slices.ContainsFunc(t.Properties, func(p *Property) bool {
+				return p.Name == name
+			}) {
+				return fmt.Errorf("conditionalrequired: no property %s", name)
+			}
+		}
+	}
+
+	// The properties of abstract types are never generated, so there's
+	// no need to check them.
+	if len(t.AbstractSubtypes) > 0 {
+		return nil
+	}
+
 	if len(t.Properties) < t.MinProperties {
 		return fmt.Errorf(
 			"%d properties < %d min properties",
@@ -182,11 +726,64 @@ func (t *TmplObject) FromToml(md toml.MetaData, primType toml.Primitive) error {
 		)
 	}
 
+	// Check that the properties that can actually be generated are
+	// enough to satisfy the limits.
+	var required, optional int
+	for _, prop := range t.Properties {
+		switch {
+		case t.excluded(prop.Name):
+		case prop.Required, slices.Contains(t.RequiredOverrides, prop.Name):
+			required++
+		default:
+			optional++
+		}
+	}
+	if required+optional < t.MinProperties {
+		return fmt.Errorf(
+			"%d required and %d optional properties not enough for %d min properties",
+			required, optional, t.MinProperties,
+		)
+	}
+	if t.MaxProperties >= 0 && required > t.MaxProperties {
+		return fmt.Errorf(
+			"%d required properties > %d max properties",
+			required, t.MaxProperties,
+		)
+	}
+
+	for _, name := range t.GenerationOrder {
+		if !slices.ContainsFunc(t.Properties, func(prop *Property) bool {
+			return prop.Name == name
+		}) {
+			return fmt.Errorf("generationorder: unknown property %q", name)
+		}
+	}
+
+	grouped := make(map[string]bool)
+	for _, group := range t.PropertyGroups {
+		for _, name := range group {
+			if !slices.ContainsFunc(t.Properties, func(prop *Property) bool {
+				return prop.Name == name
+			}) {
+				return fmt.Errorf("propertygroups: unknown property %q", name)
+			}
+			if grouped[name] {
+				return fmt.Errorf(
+					"propertygroups: property %q in more than one group", name,
+				)
+			}
+			grouped[name] = true
+		}
+	}
+
 	return nil
 }
 
 // Instantiate implements TmplNode
 func (t *TmplObject) Instantiate(gen *Generator, depth int) (any, error) {
+	if len(t.AbstractSubtypes) > 0 {
+		return gen.randomOneOf(t.AbstractSubtypes, depth)
+	}
 	return gen.generateObject(t, depth)
 }
 
@@ -201,8 +798,45 @@ type TmplArray struct {
 	MaxItems int `toml:"maxitems"`
 
 	UniqueItems bool `toml:"uniqueitems"`
+
+	// LengthDistribution is the distribution of the array lengths
+	// between MinItems and MaxItems. Can be "uniform", "geometric" or
+	// "poisson". Default is "uniform", which is also used if it's empty
+	LengthDistribution LengthDistribution `toml:"lengthdistribution"`
+
+	// Contains is the name of a type of which at least one item must be
+	// in the array, as with the contains keyword of JSON schema.
+	// Optional. Values generated for the Items type only count as
+	// matching if Items and Contains are the same type, in which case
+	// the array has at least one item.
+	Contains string `toml:"contains"`
+
+	// GroupBy is the name of a property of the items, which must be
+	// objects. If set, the items are split into groups and the items
+	// of a group share the value of this property. Optional.
+	GroupBy string `toml:"groupby"`
+
+	// PadWithFallback is the name of a type used to generate additional
+	// items if fewer than MinItems items could be generated, e.g.
+	// because unique items are hard to find. It should usually be
+	// simpler than the Items type. Optional.
+	PadWithFallback string `toml:"padwithfallback"`
 }
 
+// LengthDistribution represents the random distribution of array lengths
+type LengthDistribution string
+
+const (
+	// LengthUniform indicates that all lengths are equally likely
+	LengthUniform LengthDistribution = "uniform"
+	// LengthGeometric indicates that short arrays are much more likely
+	// than long arrays
+	LengthGeometric LengthDistribution = "geometric"
+	// LengthPoisson indicates that lengths cluster around the middle of
+	// the allowed range
+	LengthPoisson LengthDistribution = "poisson"
+)
+
 // AsMap implements TmplNode
 func (t *TmplArray) AsMap() map[string]any {
 	m := map[string]any{
@@ -218,9 +852,38 @@ func (t *TmplArray) AsMap() map[string]any {
 	if t.UniqueItems {
 		m["uniqueitems"] = t.UniqueItems
 	}
+	if t.LengthDistribution != "" && t.LengthDistribution != LengthUniform {
+		m["lengthdistribution"] = t.LengthDistribution
+	}
+	if t.Contains != "" {
+		m["contains"] = t.Contains
+	}
+	if t.GroupBy != "" {
+		m["groupby"] = t.GroupBy
+	}
+	if t.PadWithFallback != "" {
+		m["padwithfallback"] = t.PadWithFallback
+	}
 	return m
 }
 
+// FromToml implements FromToml
+func (t *TmplArray) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch t.LengthDistribution {
+	case "":
+		t.LengthDistribution = LengthUniform
+	case LengthUniform, LengthGeometric, LengthPoisson:
+	default:
+		return fmt.Errorf(
+			"unknown length distribution %q", t.LengthDistribution,
+		)
+	}
+	return nil
+}
+
 // Instantiate implements TmplNode
 func (t *TmplArray) Instantiate(gen *Generator, depth int) (any, error) {
 	return gen.randomArray(t, depth)
@@ -230,19 +893,210 @@ func (t *TmplArray) Instantiate(gen *Generator, depth int) (any, error) {
 type TmplOneOf struct {
 	// OneOf contains the types between which to choose
 	OneOf []string `toml:"oneof"`
+
+	// MinBranches is the minimum number of alternatives from which a
+	// value is generated. If it is greater than 1, up to MaxBranches
+	// alternatives are generated and their values are merged if they
+	// are all objects. Otherwise the first value is used.
+	MinBranches int `toml:"minbranches"`
+	// MaxBranches is the maximum number of alternatives from which a
+	// value is generated.
+	MaxBranches int `toml:"maxbranches"`
+
+	// ExcludeAtDepth maps names of alternatives to the minimum
+	// remaining depth at which they are eligible. Below that depth the
+	// alternative is not chosen.
+	ExcludeAtDepth map[string]int `toml:"excludeatdepth"`
+
+	// AnyOf indicates that the type was created from an anyOf in a JSON
+	// schema rather than a oneOf. It doesn't change how values are
+	// generated.
+	AnyOf bool `toml:"anyof"`
 }
 
 // AsMap implements TmplNode
 func (t *TmplOneOf) AsMap() map[string]any {
-	return map[string]any{
+	m := map[string]any{
 		"type":  "oneof",
 		"oneof": t.OneOf,
 	}
+	if t.MinBranches != 1 {
+		m["minbranches"] = t.MinBranches
+	}
+	if t.MaxBranches != 1 {
+		m["maxbranches"] = t.MaxBranches
+	}
+	if len(t.ExcludeAtDepth) > 0 {
+		m["excludeatdepth"] = t.ExcludeAtDepth
+	}
+	if t.AnyOf {
+		m["anyof"] = true
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplOneOf) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch {
+	case t.MinBranches < 1:
+		return fmt.Errorf("minbranches %d < 1", t.MinBranches)
+	case t.MaxBranches < t.MinBranches:
+		return fmt.Errorf(
+			"minbranches %d > maxbranches %d", t.MinBranches, t.MaxBranches,
+		)
+	case t.MaxBranches > len(t.OneOf):
+		return fmt.Errorf(
+			"maxbranches %d > number of alternatives %d",
+			t.MaxBranches, len(t.OneOf),
+		)
+	}
+	for name := range t.ExcludeAtDepth {
+		if !slices.Contains(t.OneOf, name) {
+			return fmt.Errorf("excludeatdepth: unknown alternative %q", name)
+		}
+	}
+	return nil
 }
 
 // Instantiate implements TmplNode
 func (t *TmplOneOf) Instantiate(gen *Generator, depth int) (any, error) {
-	return gen.randomOneOf(t.OneOf, depth)
+	if t.MinBranches > 1 {
+		return gen.multiBranchOneOf(t, depth)
+	}
+	eligible := t.eligible(depth)
+	if len(eligible) == 0 && len(t.OneOf) > 0 {
+		// all alternatives are excluded at this depth
+		return nil, ErrDepthExceeded
+	}
+	return gen.randomOneOf(eligible, depth)
+}
+
+// eligible returns the alternatives that may be chosen at the given
+// remaining depth.
+func (t *TmplOneOf) eligible(depth int) []string {
+	if len(t.ExcludeAtDepth) == 0 {
+		return t.OneOf
+	}
+	return slices.DeleteFunc(slices.Clone(t.OneOf), func(name string) bool {
+		return depth < t.ExcludeAtDepth[name]
+	})
+}
+
+// WeightedChoice is an alternative of a TmplWeightedOneOf
+type WeightedChoice struct {
+	// Type is the name of the type of the alternative
+	Type string `toml:"type"`
+
+	// Weight is the relative probability of the alternative
+	Weight float64 `toml:"weight"`
+}
+
+// TmplWeightedOneOf describes a value chosen from several types, like
+// TmplOneOf, but with some alternatives more likely than others.
+type TmplWeightedOneOf struct {
+	// Choices contains the alternatives with their weights
+	Choices []WeightedChoice `toml:"choices"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplWeightedOneOf) AsMap() map[string]any {
+	choices := make([]map[string]any, len(t.Choices))
+	for i, choice := range t.Choices {
+		choices[i] = map[string]any{
+			"type":   choice.Type,
+			"weight": choice.Weight,
+		}
+	}
+	return map[string]any{
+		"type":    "weighted_oneof",
+		"choices": choices,
+	}
+}
+
+// FromToml implements FromToml
+func (t *TmplWeightedOneOf) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if len(t.Choices) == 0 {
+		return errors.New("no choices")
+	}
+	for _, choice := range t.Choices {
+		if choice.Weight <= 0 {
+			return fmt.Errorf(
+				"weight %g of choice %s is not positive",
+				choice.Weight, choice.Type,
+			)
+		}
+	}
+	return nil
+}
+
+// Instantiate implements TmplNode
+func (t *TmplWeightedOneOf) Instantiate(gen *Generator, depth int) (any, error) {
+	return gen.weightedOneOf(t.Choices, depth)
+}
+
+// TmplConditional describes an object whose properties depend on a
+// condition, as expressed by if/then/else in a JSON schema. The
+// condition itself is not evaluated. Instead, the properties of the
+// Then types are added with probability CondProbability and the
+// properties of the Else types otherwise.
+type TmplConditional struct {
+	// Condition is the type of the object that is always generated
+	Condition string `toml:"condition"`
+
+	// Then contains the types whose properties are added if the
+	// condition is considered true
+	Then []string `toml:"then"`
+
+	// Else contains the types whose properties are added if the
+	// condition is considered false
+	Else []string `toml:"else"`
+
+	// CondProbability is the probability with which the condition is
+	// considered true. Default is 0.5
+	CondProbability float64 `toml:"condprobability"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplConditional) AsMap() map[string]any {
+	m := map[string]any{
+		"type":      "conditional",
+		"condition": t.Condition,
+	}
+	if len(t.Then) > 0 {
+		m["then"] = t.Then
+	}
+	if len(t.Else) > 0 {
+		m["else"] = t.Else
+	}
+	if t.CondProbability != 0.5 {
+		m["condprobability"] = t.CondProbability
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplConditional) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.CondProbability < 0 || t.CondProbability > 1 {
+		return fmt.Errorf(
+			"condprobability %g not in range [0, 1]",
+			t.CondProbability,
+		)
+	}
+	return nil
+}
+
+// Instantiate implements TmplNode
+func (t *TmplConditional) Instantiate(gen *Generator, depth int) (any, error) {
+	return gen.generateConditional(t, depth)
 }
 
 // TmplString describes how to generate strings
@@ -257,8 +1111,65 @@ type TmplString struct {
 
 	// Pattern represents a regular expression the string should match
 	Pattern *Pattern `toml:"pattern"`
+
+	// MaxRepeat limits unbounded repetitions like * and + in Pattern.
+	// If 0, the default of Pattern.Sample is used.
+	MaxRepeat int `toml:"maxrepeat"`
+
+	// URI indicates that the strings are URIs, so that the URI length
+	// limits apply to them in addition to the string length limits.
+	URI bool `toml:"uri"`
+
+	// MinWords is the minimum number of lorem ipsum words of the
+	// generated strings. If MinWords or MaxWords is set, they take
+	// precedence over MinLength and MaxLength.
+	MinWords *int `toml:"minwords"`
+	// MaxWords is the maximum number of lorem ipsum words of the
+	// generated strings.
+	MaxWords *int `toml:"maxwords"`
+
+	// BlacklistPatterns contains regular expressions that the generated
+	// strings must not match. Strings matching any of them are
+	// discarded and generated again.
+	BlacklistPatterns []*Pattern `toml:"blacklist"`
+
+	// ExcludePattern is a regular expression that the generated strings
+	// must not match. Strings matching it are discarded and generated
+	// again. Unlike BlacklistPatterns, it's a single regular expression.
+	ExcludePattern *Pattern `toml:"excludepattern"`
+
+	// TrimWhitespace indicates whether leading and trailing whitespace
+	// is removed from the generated strings.
+	TrimWhitespace bool `toml:"trimwhitespace"`
+	// CollapseInternalSpaces indicates whether runs of whitespace in the
+	// generated strings are replaced by a single space. This also
+	// removes leading and trailing whitespace.
+	CollapseInternalSpaces bool `toml:"collapsespaces"`
+
+	// CaseFold is applied to the generated strings after everything
+	// else. Can be "upper", "lower", "title" or "random". Default is
+	// the empty string, which leaves the strings unchanged.
+	CaseFold CaseFold `toml:"casefold"`
 }
 
+// CaseFold represents a change of the letter case of strings
+type CaseFold string
+
+const (
+	// CaseUnchanged indicates that the case is not changed
+	CaseUnchanged CaseFold = ""
+	// CaseUpper indicates that all letters are converted to upper case
+	CaseUpper CaseFold = "upper"
+	// CaseLower indicates that all letters are converted to lower case
+	CaseLower CaseFold = "lower"
+	// CaseTitle indicates that the first letter of each word is
+	// converted to upper case
+	CaseTitle CaseFold = "title"
+	// CaseRandom indicates that the case of each letter is chosen
+	// randomly
+	CaseRandom CaseFold = "random"
+)
+
 // AsMap implements TmplNode
 func (t *TmplString) AsMap() map[string]any {
 	m := map[string]any{
@@ -276,18 +1187,156 @@ func (t *TmplString) AsMap() map[string]any {
 	if t.Pattern != nil {
 		m["pattern"] = t.Pattern.Pattern
 	}
-	return m
-}
-
+	if t.MaxRepeat != 0 {
+		m["maxrepeat"] = t.MaxRepeat
+	}
+	if t.URI {
+		m["uri"] = true
+	}
+	if t.MinWords != nil {
+		m["minwords"] = *t.MinWords
+	}
+	if t.MaxWords != nil {
+		m["maxwords"] = *t.MaxWords
+	}
+	if len(t.BlacklistPatterns) > 0 {
+		blacklist := make([]string, len(t.BlacklistPatterns))
+		for i, pattern := range t.BlacklistPatterns {
+			blacklist[i] = pattern.Pattern
+		}
+		m["blacklist"] = blacklist
+	}
+	if t.ExcludePattern != nil {
+		m["excludepattern"] = t.ExcludePattern.Pattern
+	}
+	if t.TrimWhitespace {
+		m["trimwhitespace"] = true
+	}
+	if t.CollapseInternalSpaces {
+		m["collapsespaces"] = true
+	}
+	if t.CaseFold != CaseUnchanged {
+		m["casefold"] = t.CaseFold
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplString) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch t.CaseFold {
+	case CaseUnchanged, CaseUpper, CaseLower, CaseTitle, CaseRandom:
+	default:
+		return fmt.Errorf("unknown casefold %q", t.CaseFold)
+	}
+	if t.MinWords != nil && t.MaxWords != nil && *t.MaxWords < *t.MinWords {
+		return fmt.Errorf(
+			"minwords %d > maxwords %d",
+			*t.MinWords, *t.MaxWords,
+		)
+	}
+	if t.MaxRepeat < 0 {
+		return fmt.Errorf("maxrepeat %d is negative", t.MaxRepeat)
+	}
+	return nil
+}
+
 // Instantiate implements TmplNode
 func (t *TmplString) Instantiate(gen *Generator, _ int) (any, error) {
+	t = t.limited(gen.limits.stringLimit(t.URI))
+	if len(t.BlacklistPatterns) == 0 && t.ExcludePattern == nil {
+		return t.generate(gen), nil
+	}
+	for range gen.MaxItemAttempts {
+		value := t.generate(gen)
+		if !t.blacklisted(value) {
+			return value, nil
+		}
+	}
+	return nil, ErrNoValidValue
+}
+
+// limited returns t with MaxLength reduced to limit, but not below
+// MinLength. If limit is 0 or doesn't reduce MaxLength, t itself is
+// returned.
+func (t *TmplString) limited(limit int) *TmplString {
+	if limit <= 0 || t.MaxLength >= 0 && t.MaxLength <= limit {
+		return t
+	}
+	limited := *t
+	limited.MaxLength = max(limit, t.MinLength)
+	return &limited
+}
+
+// generate generates a string without checking the blacklist.
+func (t *TmplString) generate(gen *Generator) string {
+	return gen.foldCase(cleanWhitespace(
+		t.generateRaw(gen), t.TrimWhitespace, t.CollapseInternalSpaces,
+	), t.CaseFold)
+}
+
+// generateRaw generates a string without cleaning up whitespace.
+func (t *TmplString) generateRaw(gen *Generator) string {
 	if len(t.Enum) > 0 {
-		return choose(gen.Rand, t.Enum), nil
+		return choose(gen.Rand, t.Enum)
 	}
 	if t.Pattern != nil {
-		return t.Pattern.Sample(gen.Rand), nil
+		return t.samplePattern(gen)
+	}
+	if t.MinWords != nil || t.MaxWords != nil {
+		minwords, maxwords := -1, -1
+		if t.MinWords != nil {
+			minwords = *t.MinWords
+		}
+		if t.MaxWords != nil {
+			maxwords = *t.MaxWords
+		}
+		return gen.loremIpsum(minwords, maxwords, LoremWords, nil, nil)
 	}
-	return gen.randomString(t.MinLength, t.MaxLength), nil
+	return gen.randomString(t.MinLength, t.MaxLength)
+}
+
+// samplePattern generates a string matching the pattern. If the pattern
+// may generate strings that are too short or too long for MinLength and
+// MaxLength, it tries up to MaxItemAttempts times to generate a string
+// of a valid length. If the pattern can only generate strings of valid
+// lengths or only strings of invalid lengths, there's no point in
+// checking, so the first string is used.
+func (t *TmplString) samplePattern(gen *Generator) string {
+	maxRepeat := t.MaxRepeat
+	if maxRepeat == 0 {
+		maxRepeat = defaultMaxRepeat
+	}
+	value := t.Pattern.SampleWithMaxRepeat(gen.Rand, maxRepeat)
+	minLength, maxLength := t.Pattern.MinLength(), t.Pattern.maxLength(maxRepeat)
+	lower := max(t.MinLength, 0)
+	upper := t.MaxLength
+	if upper < 0 {
+		upper = math.MaxInt
+	}
+	if minLength >= lower && maxLength <= upper || maxLength < lower || minLength > upper {
+		return value
+	}
+	for range gen.MaxItemAttempts - 1 {
+		if n := utf8.RuneCountInString(value); n >= lower && n <= upper {
+			break
+		}
+		value = t.Pattern.SampleWithMaxRepeat(gen.Rand, maxRepeat)
+	}
+	return value
+}
+
+// blacklisted reports whether value matches the exclude pattern or one
+// of the blacklist patterns.
+func (t *TmplString) blacklisted(value string) bool {
+	if t.ExcludePattern != nil && t.ExcludePattern.Matches(value) {
+		return true
+	}
+	return slices.ContainsFunc(t.BlacklistPatterns, func(pattern *Pattern) bool {
+		return pattern.Matches(value)
+	})
 }
 
 // TmplLorem describes how to generate strings
@@ -299,6 +1348,36 @@ type TmplLorem struct {
 	// Unit for max/min length. Can be "words", "sentences" or
 	// "paragraphs". Default is "words"
 	Unit LoremUnit
+
+	// MinWordsPerSentence is the minimum number of words in a
+	// sentence. The fields describing the structure of sentences and
+	// paragraphs are only used if at least one of them is not zero.
+	// Otherwise, the structure is determined by the lorem ipsum
+	// library.
+	MinWordsPerSentence int `toml:"minwordspersentence"`
+	// MaxWordsPerSentence is the maximum number of words in a sentence.
+	MaxWordsPerSentence int `toml:"maxwordspersentence"`
+	// MinSentencesPerParagraph is the minimum number of sentences in a
+	// paragraph.
+	MinSentencesPerParagraph int `toml:"minsentencesperparagraph"`
+	// MaxSentencesPerParagraph is the maximum number of sentences in a
+	// paragraph.
+	MaxSentencesPerParagraph int `toml:"maxsentencesperparagraph"`
+
+	// Locale is an IETF BCP 47 language tag like "de" or "ja". If set,
+	// the text is generated from a vocabulary of that language instead
+	// of lorem ipsum. Supported languages are German, French,
+	// Japanese and Chinese.
+	Locale string `toml:"locale"`
+
+	// TrimWhitespace indicates whether leading and trailing whitespace
+	// is removed from the generated strings.
+	TrimWhitespace bool `toml:"trimwhitespace"`
+	// CollapseInternalSpaces indicates whether runs of whitespace in the
+	// generated strings, including the newlines separating paragraphs,
+	// are replaced by a single space. This also removes leading and
+	// trailing whitespace.
+	CollapseInternalSpaces bool `toml:"collapsespaces"`
 }
 
 // LoremUnit represents the granularity of the lorem ipsum generator
@@ -312,6 +1391,13 @@ type TmplBook struct {
 	MaxLength int `toml:"maxlength"`
 	// Path is the location of the text file
 	Path string `toml:"path"`
+	// Paths are the locations of several text files, one of which is
+	// chosen randomly for each generated string. Alternative to Path.
+	Paths []string `toml:"paths"`
+	// SentenceBoundary indicates whether the text should end at the
+	// sentence boundary closest to the randomly chosen length, if
+	// there is one within the length limits.
+	SentenceBoundary bool `toml:"sentenceboundary"`
 }
 
 const (
@@ -337,12 +1423,101 @@ func (t *TmplLorem) AsMap() map[string]any {
 	if t.Unit != LoremWords {
 		m["unit"] = t.Unit
 	}
+	if t.MinWordsPerSentence != 0 {
+		m["minwordspersentence"] = t.MinWordsPerSentence
+	}
+	if t.MaxWordsPerSentence != 0 {
+		m["maxwordspersentence"] = t.MaxWordsPerSentence
+	}
+	if t.MinSentencesPerParagraph != 0 {
+		m["minsentencesperparagraph"] = t.MinSentencesPerParagraph
+	}
+	if t.MaxSentencesPerParagraph != 0 {
+		m["maxsentencesperparagraph"] = t.MaxSentencesPerParagraph
+	}
+	if t.Locale != "" {
+		m["locale"] = t.Locale
+	}
+	if t.TrimWhitespace {
+		m["trimwhitespace"] = true
+	}
+	if t.CollapseInternalSpaces {
+		m["collapsespaces"] = true
+	}
 	return m
 }
 
+// FromToml implements FromToml
+func (t *TmplLorem) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	check := func(what string, minimum, maximum int) error {
+		if minimum < 0 || maximum < 0 {
+			return fmt.Errorf("negative number of %s", what)
+		}
+		if maximum > 0 && minimum > maximum {
+			return fmt.Errorf(
+				"minimum %d > maximum %d of %s", minimum, maximum, what,
+			)
+		}
+		return nil
+	}
+	var localeErr error
+	if t.Locale != "" {
+		_, localeErr = lookupLoremLocale(t.Locale)
+	}
+	return errors.Join(
+		check("words per sentence",
+			t.MinWordsPerSentence, t.MaxWordsPerSentence),
+		check("sentences per paragraph",
+			t.MinSentencesPerParagraph, t.MaxSentencesPerParagraph),
+		localeErr,
+	)
+}
+
+// structure returns the sentence and paragraph structure of the text or
+// nil if the defaults of the lorem ipsum library should be used.
+func (t *TmplLorem) structure() *loremStructure {
+	if t.MinWordsPerSentence == 0 && t.MaxWordsPerSentence == 0 &&
+		t.MinSentencesPerParagraph == 0 && t.MaxSentencesPerParagraph == 0 {
+		return nil
+	}
+	return &loremStructure{
+		minWords:     t.MinWordsPerSentence,
+		maxWords:     t.MaxWordsPerSentence,
+		minSentences: t.MinSentencesPerParagraph,
+		maxSentences: t.MaxSentencesPerParagraph,
+	}
+}
+
 // Instantiate implements TmplNode
 func (t *TmplLorem) Instantiate(gen *Generator, _ int) (any, error) {
-	return gen.loremIpsum(t.MinLength, t.MaxLength, t.Unit), nil
+	var locale *loremLocale
+	if t.Locale != "" {
+		var err error
+		if locale, err = lookupLoremLocale(t.Locale); err != nil {
+			return nil, err
+		}
+	}
+	text := gen.loremIpsum(t.MinLength, t.MaxLength, t.Unit, t.structure(), locale)
+	return cleanWhitespace(
+		text, t.TrimWhitespace, t.CollapseInternalSpaces,
+	), nil
+}
+
+// cleanWhitespace removes leading and trailing whitespace from s if
+// trim is true and replaces runs of whitespace with a single space if
+// collapse is true. Collapsing whitespace implies trimming it.
+func cleanWhitespace(s string, trim, collapse bool) string {
+	switch {
+	case collapse:
+		return strings.Join(strings.Fields(s), " ")
+	case trim:
+		return strings.TrimSpace(s)
+	default:
+		return s
+	}
 }
 
 // AsMap implements TmplNode
@@ -359,12 +1534,36 @@ func (t *TmplBook) AsMap() map[string]any {
 	if t.Path != "" {
 		m["path"] = t.Path
 	}
+	if len(t.Paths) > 0 {
+		m["paths"] = t.Paths
+	}
+	if t.SentenceBoundary {
+		m["sentenceboundary"] = t.SentenceBoundary
+	}
 	return m
 }
 
+// FromToml implements FromToml
+func (t *TmplBook) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch {
+	case t.Path != "" && len(t.Paths) > 0:
+		return errors.New("only one of path and paths may be given")
+	case t.Path == "" && len(t.Paths) == 0:
+		return errors.New("path or paths must be given")
+	}
+	return nil
+}
+
 // Instantiate implements TmplNode
 func (t *TmplBook) Instantiate(gen *Generator, _ int) (any, error) {
-	return gen.book(t.MinLength, t.MaxLength, t.Path)
+	path := t.Path
+	if len(t.Paths) > 0 {
+		path = t.Paths[gen.Rand.IntN(len(t.Paths))]
+	}
+	return gen.book(t.MinLength, t.MaxLength, path, t.SentenceBoundary)
 }
 
 // TmplID describes how to generate IDs that may be referenced from
@@ -372,19 +1571,46 @@ func (t *TmplBook) Instantiate(gen *Generator, _ int) (any, error) {
 type TmplID struct {
 	// Namespace is the namespace for the IDs
 	Namespace string `toml:"namespace"`
+
+	// MinLength is the minimum length of the generated IDs. If it is 0
+	// or negative, the minimum length is 1.
+	MinLength int `toml:"minlength"`
+	// MaxLength is the maximum length of the generated IDs. If it is 0
+	// or negative, the maximum length is 20.
+	MaxLength int `toml:"maxlength"`
 }
 
 // AsMap implements TmplNode
 func (t *TmplID) AsMap() map[string]any {
-	return map[string]any{
+	m := map[string]any{
 		"type":      "id",
 		"namespace": t.Namespace,
 	}
+	if t.MinLength > 0 {
+		m["minlength"] = t.MinLength
+	}
+	if t.MaxLength > 0 {
+		m["maxlength"] = t.MaxLength
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplID) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.MaxLength > 0 && t.MaxLength < t.MinLength {
+		return fmt.Errorf(
+			"invalid ID length range %d..%d", t.MinLength, t.MaxLength,
+		)
+	}
+	return nil
 }
 
 // Instantiate implements TmplNode
 func (t *TmplID) Instantiate(gen *Generator, _ int) (any, error) {
-	return gen.generateID(t.Namespace), nil
+	return gen.generateID(t.Namespace, t.MinLength, t.MaxLength), nil
 }
 
 // TmplRef generate strings that are chosen from the IDs generated for
@@ -392,21 +1618,91 @@ func (t *TmplID) Instantiate(gen *Generator, _ int) (any, error) {
 type TmplRef struct {
 	// Namespace is the namespace for the IDs
 	Namespace string `toml:"namespace"`
+
+	// Multiple indicates whether the generated value is an array of
+	// different IDs instead of a single ID.
+	Multiple bool `toml:"multiple"`
+
+	// MinCount is the minimum number of IDs to reference if Multiple
+	// is true.
+	MinCount int `toml:"mincount"`
+
+	// MaxCount is the maximum number of IDs to reference if Multiple
+	// is true. 0 means no limit other than the number of IDs
+	// available.
+	MaxCount int `toml:"maxcount"`
 }
 
 // AsMap implements TmplNode
 func (t *TmplRef) AsMap() map[string]any {
-	return map[string]any{
+	m := map[string]any{
 		"type":      "ref",
 		"namespace": t.Namespace,
 	}
+	if t.Multiple {
+		m["multiple"] = true
+	}
+	if t.MinCount != 0 {
+		m["mincount"] = t.MinCount
+	}
+	if t.MaxCount != 0 {
+		m["maxcount"] = t.MaxCount
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplRef) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch {
+	case t.MinCount < 0:
+		return fmt.Errorf("mincount %d is negative", t.MinCount)
+	case t.MaxCount < 0:
+		return fmt.Errorf("maxcount %d is negative", t.MaxCount)
+	case t.MaxCount > 0 && t.MinCount > t.MaxCount:
+		return fmt.Errorf(
+			"mincount %d > maxcount %d",
+			t.MinCount, t.MaxCount,
+		)
+	}
+	return nil
 }
 
 // Instantiate implements TmplNode
 func (t *TmplRef) Instantiate(gen *Generator, _ int) (any, error) {
+	if t.Multiple {
+		maxCount := t.MaxCount
+		if maxCount == 0 {
+			maxCount = -1
+		}
+		return gen.generateReferences(t.Namespace, max(t.MinCount, 0), maxCount)
+	}
 	return gen.generateReference(t.Namespace)
 }
 
+// TmplVarRef generates the value of one of the generator's template
+// variables. This can be used to coordinate values in different parts
+// of the document.
+type TmplVarRef struct {
+	// Name is the name of the variable
+	Name string `toml:"name"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplVarRef) AsMap() map[string]any {
+	return map[string]any{
+		"type": "varref",
+		"name": t.Name,
+	}
+}
+
+// Instantiate implements TmplNode
+func (t *TmplVarRef) Instantiate(gen *Generator, _ int) (any, error) {
+	return gen.TemplateVars[t.Name], nil
+}
+
 // TmplNumber describes how to generate numbers
 type TmplNumber struct {
 	// Minimum is the minum value of the generated numbers
@@ -431,23 +1727,375 @@ func (t *TmplNumber) AsMap() map[string]any {
 }
 
 // Instantiate implements TmplNode
-func (t *TmplNumber) Instantiate(gen *Generator, _ int) (any, error) {
-	return gen.randomNumber(t.Minimum, t.Maximum), nil
+func (t *TmplNumber) Instantiate(gen *Generator, _ int) (any, error) {
+	return gen.randomNumber(t.Minimum, t.Maximum), nil
+}
+
+// TmplInteger describes how to generate integers
+type TmplInteger struct {
+	// Minimum is the minimum value of the generated integers
+	Minimum *int64 `toml:"minimum"`
+
+	// Maximum is the maximum value of the generated integers
+	Maximum *int64 `toml:"maximum"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplInteger) AsMap() map[string]any {
+	m := map[string]any{
+		"type": "integer",
+	}
+	if t.Minimum != nil {
+		m["minimum"] = *t.Minimum
+	}
+	if t.Maximum != nil {
+		m["maximum"] = *t.Maximum
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplInteger) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.Minimum != nil && t.Maximum != nil && *t.Minimum > *t.Maximum {
+		return fmt.Errorf("minimum %d > maximum %d", *t.Minimum, *t.Maximum)
+	}
+	return nil
+}
+
+// Instantiate implements TmplNode
+func (t *TmplInteger) Instantiate(gen *Generator, _ int) (any, error) {
+	return gen.randomInteger(t.Minimum, t.Maximum), nil
+}
+
+// TmplBool describes how to generate boolean values
+type TmplBool struct {
+	// Probability is the probability with which true is generated.
+	// Default is 0.5
+	Probability float64 `toml:"probability"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplBool) AsMap() map[string]any {
+	m := map[string]any{
+		"type": "bool",
+	}
+	if t.Probability != 0.5 {
+		m["probability"] = t.Probability
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplBool) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.Probability < 0 || t.Probability > 1 {
+		return fmt.Errorf(
+			"probability %g not in range [0, 1]", t.Probability,
+		)
+	}
+	return nil
+}
+
+// Instantiate implements TmplNode
+func (t *TmplBool) Instantiate(gen *Generator, _ int) (any, error) {
+	return gen.Rand.Float64() < t.Probability, nil
+}
+
+// TmplNull describes the JSON null value
+type TmplNull struct{}
+
+// AsMap implements TmplNode
+func (t *TmplNull) AsMap() map[string]any {
+	return map[string]any{
+		"type": "null",
+	}
+}
+
+// Instantiate implements TmplNode
+func (t *TmplNull) Instantiate(*Generator, int) (any, error) {
+	return nil, nil
+}
+
+// TmplConst describes a fixed value
+type TmplConst struct {
+	// Value is the value. It's a string, int64, float64 or bool.
+	Value any `toml:"value"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplConst) AsMap() map[string]any {
+	return map[string]any{
+		"type":  "const",
+		"value": t.Value,
+	}
+}
+
+// FromToml implements FromToml
+func (t *TmplConst) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	switch t.Value.(type) {
+	case string, int64, float64, bool:
+		return nil
+	case nil:
+		return errors.New("missing value")
+	default:
+		return fmt.Errorf("unsupported type of value: %T", t.Value)
+	}
+}
+
+// Instantiate implements TmplNode
+func (t *TmplConst) Instantiate(*Generator, int) (any, error) {
+	return t.Value, nil
+}
+
+// TmplIPv4 describes how to generate IPv4 addresses
+type TmplIPv4 struct {
+	// Private indicates whether only addresses from the private
+	// address ranges of RFC 1918 are generated
+	Private bool `toml:"private"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplIPv4) AsMap() map[string]any {
+	m := map[string]any{
+		"type": "ipv4",
+	}
+	if t.Private {
+		m["private"] = true
+	}
+	return m
+}
+
+// Instantiate implements TmplNode
+func (t *TmplIPv4) Instantiate(gen *Generator, _ int) (any, error) {
+	var octets [4]int
+	for i := range octets {
+		octets[i] = gen.Rand.IntN(256)
+	}
+	if t.Private {
+		switch gen.Rand.IntN(3) {
+		case 0:
+			octets[0] = 10
+		case 1:
+			octets[0], octets[1] = 172, 16+gen.Rand.IntN(16)
+		default:
+			octets[0], octets[1] = 192, 168
+		}
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", octets[0], octets[1], octets[2], octets[3]), nil
+}
+
+// TmplCVE describes how to generate CVE IDs of the form CVE-YYYY-NNNN.
+// Fields with the value 0 use the default.
+type TmplCVE struct {
+	// YearMin is the minimum year. Default 1999
+	YearMin int `toml:"yearmin"`
+
+	// YearMax is the maximum year. Default 2025
+	YearMax int `toml:"yearmax"`
+
+	// IDMin is the minimum sequence number. Default 1
+	IDMin int `toml:"idmin"`
+
+	// IDMax is the maximum sequence number. Default 99999
+	IDMax int `toml:"idmax"`
+}
+
+// newTmplCVE returns a TmplCVE with the default ranges
+func newTmplCVE() *TmplCVE {
+	return &TmplCVE{
+		YearMin: 1999,
+		YearMax: 2025,
+		IDMin:   1,
+		IDMax:   99999,
+	}
+}
+
+// withDefaults returns a copy of t with the defaults filled in for the
+// fields with the value 0.
+func (t *TmplCVE) withDefaults() TmplCVE {
+	defaults := newTmplCVE()
+	orDefault := func(value, def int) int {
+		if value == 0 {
+			return def
+		}
+		return value
+	}
+	return TmplCVE{
+		YearMin: orDefault(t.YearMin, defaults.YearMin),
+		YearMax: orDefault(t.YearMax, defaults.YearMax),
+		IDMin:   orDefault(t.IDMin, defaults.IDMin),
+		IDMax:   orDefault(t.IDMax, defaults.IDMax),
+	}
+}
+
+// check returns an error if the ranges of t are invalid.
+func (t *TmplCVE) check() error {
+	if t.YearMin < 1000 || t.YearMax > 9999 || t.YearMin > t.YearMax {
+		return fmt.Errorf(
+			"year range %d..%d invalid, must be within 1000..9999",
+			t.YearMin, t.YearMax,
+		)
+	}
+	if t.IDMin < 0 || t.IDMin > t.IDMax {
+		return fmt.Errorf("id range %d..%d invalid", t.IDMin, t.IDMax)
+	}
+	return nil
+}
+
+// AsMap implements TmplNode
+func (t *TmplCVE) AsMap() map[string]any {
+	m := map[string]any{
+		"type": "cve",
+	}
+	cve, defaults := t.withDefaults(), newTmplCVE()
+	if cve.YearMin != defaults.YearMin {
+		m["yearmin"] = cve.YearMin
+	}
+	if cve.YearMax != defaults.YearMax {
+		m["yearmax"] = cve.YearMax
+	}
+	if cve.IDMin != defaults.IDMin {
+		m["idmin"] = cve.IDMin
+	}
+	if cve.IDMax != defaults.IDMax {
+		m["idmax"] = cve.IDMax
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplCVE) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	*t = t.withDefaults()
+	return t.check()
+}
+
+// Instantiate implements TmplNode
+func (t *TmplCVE) Instantiate(gen *Generator, _ int) (any, error) {
+	cve := t.withDefaults()
+	if err := cve.check(); err != nil {
+		return nil, err
+	}
+	year := cve.YearMin + gen.Rand.IntN(cve.YearMax-cve.YearMin+1)
+	id := cve.IDMin + gen.Rand.IntN(cve.IDMax-cve.IDMin+1)
+	return fmt.Sprintf("CVE-%d-%04d", year, id), nil
+}
+
+// TmplEmail describes how to generate email addresses
+type TmplEmail struct{}
+
+// emailTLDs are the top level domains of generated email addresses
+var emailTLDs = []string{"com", "org", "net", "de", "io"}
+
+// AsMap implements TmplNode
+func (t *TmplEmail) AsMap() map[string]any {
+	return map[string]any{
+		"type": "email",
+	}
+}
+
+// Instantiate implements TmplNode
+func (t *TmplEmail) Instantiate(gen *Generator, _ int) (any, error) {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	word := func(minlength, maxlength int) string {
+		b := make([]byte, gen.chooseLength(minlength, maxlength))
+		for i := range b {
+			b[i] = chars[gen.Rand.IntN(len(chars))]
+		}
+		return string(b)
+	}
+	local := word(3, 10)
+	domain := word(5, 12)
+	return local + "@" + domain + "." + choose(gen.Rand, emailTLDs), nil
+}
+
+// TmplDateTime describes how to generate date/time values
+type TmplDateTime struct {
+	// Minimum is the minum value of the generated date/time values
+	Minimum *time.Time `toml:"minimum"`
+
+	// Maximum is the maximum value of the generated  date/time values
+	Maximum *time.Time `toml:"maximum"`
+
+	// Format is the layout used to format the generated values as
+	// described for time.Time.Format. If empty, the values are in
+	// RFC 3339 format.
+	Format string `toml:"format"`
+}
+
+// AsMap implements TmplNode
+func (t *TmplDateTime) AsMap() map[string]any {
+	m := map[string]any{
+		"type": "date-time",
+	}
+	if t.Minimum != nil {
+		m["minimum"] = *t.Minimum
+	}
+	if t.Maximum != nil {
+		m["maximum"] = *t.Maximum
+	}
+	if t.Format != "" {
+		m["format"] = t.Format
+	}
+	return m
+}
+
+// FromToml implements FromToml
+func (t *TmplDateTime) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.Format != "" {
+		// Check the layout by formatting a time and parsing the result.
+		// The time must differ from the reference time of the layouts
+		// in all fields, otherwise valid layouts format to themselves.
+		sample := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		formatted := sample.Format(t.Format)
+		if formatted == t.Format {
+			return fmt.Errorf(
+				"format %q contains no date or time elements", t.Format,
+			)
+		}
+		if _, err := time.Parse(t.Format, formatted); err != nil {
+			return fmt.Errorf("invalid format %q: %w", t.Format, err)
+		}
+	}
+	return nil
+}
+
+// Instantiate implements TmplNode
+func (t *TmplDateTime) Instantiate(gen *Generator, _ int) (any, error) {
+	value := gen.randomDateTime(t.Minimum, t.Maximum)
+	if t.Format != "" {
+		return value.Format(t.Format), nil
+	}
+	return value, nil
 }
 
-// TmplDateTime describes how to generate date/time values
-type TmplDateTime struct {
-	// Minimum is the minum value of the generated date/time values
+// TmplDate describes how to generate dates without time in the format
+// YYYY-MM-DD
+type TmplDate struct {
+	// Minimum is the minimum value of the generated dates
 	Minimum *time.Time `toml:"minimum"`
 
-	// Maximum is the maximum value of the generated  date/time values
+	// Maximum is the maximum value of the generated dates
 	Maximum *time.Time `toml:"maximum"`
 }
 
 // AsMap implements TmplNode
-func (t *TmplDateTime) AsMap() map[string]any {
+func (t *TmplDate) AsMap() map[string]any {
 	m := map[string]any{
-		"type": "date-time",
+		"type": "date",
 	}
 	if t.Minimum != nil {
 		m["minimum"] = *t.Minimum
@@ -458,48 +2106,162 @@ func (t *TmplDateTime) AsMap() map[string]any {
 	return m
 }
 
+// FromToml implements FromToml
+func (t *TmplDate) FromToml(md toml.MetaData, primType toml.Primitive) error {
+	if err := md.PrimitiveDecode(primType, t); err != nil {
+		return err
+	}
+	if t.Minimum != nil && t.Maximum != nil && t.Minimum.After(*t.Maximum) {
+		return fmt.Errorf("minimum %v after maximum %v", *t.Minimum, *t.Maximum)
+	}
+	return nil
+}
+
 // Instantiate implements TmplNode
-func (t *TmplDateTime) Instantiate(gen *Generator, _ int) (any, error) {
-	return gen.randomDateTime(t.Minimum, t.Maximum), nil
+func (t *TmplDate) Instantiate(gen *Generator, _ int) (any, error) {
+	return gen.randomDateTime(t.Minimum, t.Maximum).Format(time.DateOnly), nil
+}
+
+// FromSchemaOptions holds the options for creating templates from JSON
+// schemas.
+type FromSchemaOptions struct {
+	// ApplyCSAFSpecials indicates whether the CSAF specific adjustments
+	// are applied to the template, e.g. generating product IDs with
+	// the id/ref mechanism. Default is true. The adjustments fail for
+	// schemas other than the built-in CSAF schema, so this must be
+	// disabled for them.
+	ApplyCSAFSpecials bool
+
+	// CollectErrors indicates whether the conversion continues after a
+	// schema cannot be converted, so that all errors are reported
+	// together. Default is false.
+	CollectErrors bool
+}
+
+// FromSchemaOption modifies FromSchemaOptions.
+type FromSchemaOption func(*FromSchemaOptions)
+
+// WithoutCSAFSpecials is a FromSchemaOption that disables the CSAF
+// specific adjustments of the template.
+func WithoutCSAFSpecials() FromSchemaOption {
+	return func(opts *FromSchemaOptions) {
+		opts.ApplyCSAFSpecials = false
+	}
+}
+
+// WithCollectErrors is a FromSchemaOption that makes the conversion
+// report all errors instead of stopping at the first one.
+func WithCollectErrors() FromSchemaOption {
+	return func(opts *FromSchemaOptions) {
+		opts.CollectErrors = true
+	}
+}
+
+func newFromSchemaOptions(opts []FromSchemaOption) *FromSchemaOptions {
+	options := &FromSchemaOptions{
+		ApplyCSAFSpecials: true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
 }
 
 // FromCSAFSchema creates a new template from the built-in CSAF JSON
 // schema
-func FromCSAFSchema() (*Template, error) {
+func FromCSAFSchema(opts ...FromSchemaOption) (*Template, error) {
 	schema, err := CompileSchema()
 	if err != nil {
 		return nil, err
 	}
 
-	return FromSchema(schema)
+	return FromSchema(schema, opts...)
+}
+
+// FromSchemaBytes creates a new template from the JSON schema contained
+// in data. See CompileSchemaFromBytes for the meaning of baseURL.
+func FromSchemaBytes(
+	data []byte,
+	baseURL string,
+	opts ...FromSchemaOption,
+) (*Template, error) {
+	schema, err := CompileSchemaFromBytes(data, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromSchema(schema, opts...)
 }
 
 // FromSchema creates a default template from a JSON schema.
-func FromSchema(schema *jsonschema.Schema) (*Template, error) {
+func FromSchema(
+	schema *jsonschema.Schema,
+	opts ...FromSchemaOption,
+) (*Template, error) {
+	options := newFromSchemaOptions(opts)
 	template := &Template{
 		Types: make(map[string]TmplNode),
 		Root:  "",
 	}
-	root, err := template.fromSchema(schema)
+	var errs []error
+	if options.CollectErrors {
+		template.schemaErrors = &errs
+	}
+	root, err := template.fromSchema(schema, 0)
+	template.schemaErrors = nil
 	if err != nil {
 		return nil, err
 	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 	template.Root = root
 
-	if err := template.applyCSAFSpecials(); err != nil {
-		return nil, err
+	if options.ApplyCSAFSpecials {
+		if err := template.applyCSAFSpecials(); err != nil {
+			return nil, err
+		}
 	}
 
 	return template, nil
 }
 
-func (t *Template) fromSchema(origschema *jsonschema.Schema) (string, error) {
+// maxSchemaDepth is the maximum nesting depth of the schemas handled by
+// fromSchema. It guards against excessively deep Go call stacks.
+const maxSchemaDepth = 200
+
+// fromSchema creates the template node for a schema and returns the
+// name of its type. The depth is the nesting depth of the schema,
+// starting with 0 for the root schema. If errors are collected, an
+// error is recorded with the location of the schema and the empty
+// string is returned as the name.
+func (t *Template) fromSchema(
+	schema *jsonschema.Schema,
+	depth int,
+) (string, error) {
+	name, err := t.typeFromSchema(schema, depth)
+	if err != nil && t.schemaErrors != nil {
+		*t.schemaErrors = append(*t.schemaErrors,
+			fmt.Errorf("%s: %w", schema.Location, err))
+		return "", nil
+	}
+	return name, err
+}
+
+// typeFromSchema implements fromSchema.
+func (t *Template) typeFromSchema(
+	origschema *jsonschema.Schema,
+	depth int,
+) (string, error) {
 	ty, schema, err := getType(origschema)
 	if err != nil {
 		return "", err
 	}
 
 	name := ShortLocation(schema)
+	if depth > maxSchemaDepth {
+		return "", fmt.Errorf("schema too deeply nested at %s", name)
+	}
 
 	// Check for recursion. If name is already in t.Types, we don't have
 	// to do anything. If the associated value is nil, we're currently
@@ -510,66 +2272,116 @@ func (t *Template) fromSchema(origschema *jsonschema.Schema) (string, error) {
 	}
 	t.Types[name] = nil
 
+	if ty == "multi" {
+		if err := t.multiTypeFromSchema(name, schema, depth); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+	if err := t.nodeFromSchema(name, ty, schema, depth); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// nodeFromSchema creates the template node of the given type for a
+// schema and stores it in t.Types under name.
+func (t *Template) nodeFromSchema(
+	name, ty string,
+	schema *jsonschema.Schema,
+	depth int,
+) error {
 	switch ty {
 	case "object":
-		required := make(map[string]bool, len(schema.Required))
-		for _, name := range schema.Required {
-			required[name] = true
+		obj, err := t.objectFromSchema(schema, nil, depth)
+		if err != nil {
+			return err
 		}
-
-		properties := []*Property{}
-		for propName, prop := range schema.Properties {
-			propType, err := t.fromSchema(prop)
-			if err != nil {
-				return "", err
-			}
-			properties = append(properties, &Property{
-				Name:     propName,
-				Type:     propType,
-				Required: required[propName],
-			})
+		if err := t.additionalFromSchema(obj, schema, depth); err != nil {
+			return err
 		}
-		// Sort properties by name to make the output deterministic
-		slices.SortFunc(properties, func(p1, p2 *Property) int {
-			return cmp.Compare(p1.Name, p2.Name)
-		})
-
-		t.Types[name] = &TmplObject{
-			Properties:    properties,
-			MinProperties: schema.MinProperties,
-			MaxProperties: schema.MaxProperties,
+		if group, ok := conditionalRequiredFromSchema(schema); ok {
+			obj.ConditionalRequired = append(obj.ConditionalRequired, group)
+			t.Types[name] = obj
+			break
+		}
+		if schema.If == nil {
+			t.Types[name] = obj
+			break
 		}
+		cond, err := t.conditionalFromSchema(name, schema, obj, depth)
+		if err != nil {
+			return err
+		}
+		t.Types[name] = cond
 	case "array":
-		itemsType, err := t.fromSchema(schema.Items2020)
+		itemsType, err := t.fromSchema(schema.Items2020, depth+1)
 		if err != nil {
-			return "", err
+			return err
+		}
+		var containsType string
+		if schema.Contains != nil {
+			containsType, err = t.fromSchema(schema.Contains, depth+1)
+			if err != nil {
+				return err
+			}
 		}
 		t.Types[name] = &TmplArray{
-			Items:       itemsType,
-			MinItems:    schema.MinItems,
-			MaxItems:    schema.MaxItems,
-			UniqueItems: schema.UniqueItems,
+			Items:              itemsType,
+			MinItems:           schema.MinItems,
+			MaxItems:           schema.MaxItems,
+			UniqueItems:        schema.UniqueItems,
+			LengthDistribution: LengthUniform,
+			Contains:           containsType,
+		}
+	case "oneof", "anyof":
+		// For generating values, anyOf is treated like oneOf, i.e.
+		// the value is generated from just one of the alternatives.
+		// The origin is kept so that templates can tell them apart.
+		alternatives := schema.OneOf
+		if ty == "anyof" {
+			alternatives = schema.AnyOf
 		}
-	case "oneof":
 		oneof := []string{}
-		for _, alternative := range schema.OneOf {
-			altType, err := t.fromSchema(alternative)
+		for _, alternative := range alternatives {
+			altType, err := t.fromSchema(alternative, depth+1)
 			if err != nil {
-				return "", err
+				return err
 			}
 			oneof = append(oneof, altType)
 		}
-		t.Types[name] = &TmplOneOf{OneOf: oneof}
+		t.Types[name] = &TmplOneOf{
+			OneOf:       oneof,
+			MinBranches: 1,
+			MaxBranches: 1,
+			AnyOf:       ty == "anyof",
+		}
 	case "string":
 		switch schema.Format {
 		case "date-time":
 			mindate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
 			maxdate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
 			t.Types[name] = &TmplDateTime{Minimum: &mindate, Maximum: &maxdate}
+		case "date":
+			mindate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			maxdate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			t.Types[name] = &TmplDate{Minimum: &mindate, Maximum: &maxdate}
+		case "ipv4":
+			t.Types[name] = &TmplIPv4{}
+		case "email":
+			t.Types[name] = &TmplEmail{}
 		default:
+			if schema.Pattern != nil && schema.Pattern.String() == cveRegexp {
+				t.Types[name] = newTmplCVE()
+				break
+			}
+			// Schemas with multiple types may have enum values that
+			// aren't strings.
 			enum := []string{}
 			for _, v := range schema.Enum {
-				enum = append(enum, v.(string))
+				if s, ok := v.(string); ok {
+					enum = append(enum, s)
+				}
 			}
 			regexp := ""
 			if schema.Pattern != nil {
@@ -581,9 +2393,10 @@ func (t *Template) fromSchema(origschema *jsonschema.Schema) (string, error) {
 
 			var pattern *Pattern
 			if regexp != "" {
+				var err error
 				pattern, err = CompileRegexp(regexp)
 				if err != nil {
-					return "", err
+					return err
 				}
 			}
 
@@ -592,6 +2405,7 @@ func (t *Template) fromSchema(origschema *jsonschema.Schema) (string, error) {
 				MaxLength: schema.MaxLength,
 				Enum:      enum,
 				Pattern:   pattern,
+				URI:       schema.Format == "uri",
 			}
 		}
 	case "number":
@@ -608,13 +2422,323 @@ func (t *Template) fromSchema(origschema *jsonschema.Schema) (string, error) {
 			Minimum: minimum,
 			Maximum: maximum,
 		}
+	case "integer":
+		var minimum, maximum *int64
+		if schema.Minimum != nil {
+			m := ratToInt64(schema.Minimum, math.Ceil)
+			minimum = &m
+		}
+		if schema.Maximum != nil {
+			m := ratToInt64(schema.Maximum, math.Floor)
+			maximum = &m
+		}
+		t.Types[name] = &TmplInteger{
+			Minimum: minimum,
+			Maximum: maximum,
+		}
+	case "boolean":
+		t.Types[name] = &TmplBool{Probability: 0.5}
+	case "null":
+		t.Types[name] = &TmplNull{}
+	case "const":
+		value, _ := constValue(schema)
+		t.Types[name] = &TmplConst{Value: value}
+	case "allof":
+		propSchemas, required, err := mergeAllOf(schema)
+		if err != nil {
+			return err
+		}
+		obj, err := t.objectFromProperties(
+			propSchemas, required,
+			schema.MinProperties, schema.MaxProperties,
+			depth,
+		)
+		if err != nil {
+			return err
+		}
+		if err := t.additionalFromSchema(obj, schema, depth); err != nil {
+			return err
+		}
+		t.Types[name] = obj
 	default:
-		return "", fmt.Errorf("unexpected type: %s", ty)
+		return fmt.Errorf("unexpected type: %s", ty)
 	}
-	return name, nil
+	return nil
+}
+
+// multiTypeFromSchema creates a TmplOneOf for a schema with multiple
+// types, e.g. ["string", "null"] for nullable strings. Each alternative
+// is generated from the schema restricted to one of the types and is
+// stored with the type appended to name.
+func (t *Template) multiTypeFromSchema(
+	name string,
+	schema *jsonschema.Schema,
+	depth int,
+) error {
+	var oneof []string
+	for _, ty := range schema.Types {
+		altName := name + "/" + ty
+		if _, ok := t.Types[altName]; !ok {
+			t.Types[altName] = nil
+			if err := t.nodeFromSchema(altName, ty, schema, depth); err != nil {
+				return err
+			}
+		}
+		oneof = append(oneof, altName)
+	}
+	t.Types[name] = &TmplOneOf{
+		OneOf:       oneof,
+		MinBranches: 1,
+		MaxBranches: 1,
+	}
+	return nil
+}
+
+// objectFromSchema creates a TmplObject from an object schema. If base
+// is not nil, properties that are required by schema but not defined in
+// schema itself are taken from base. This is used for the then and else
+// parts of conditionals which usually only list required properties.
+func (t *Template) objectFromSchema(
+	schema, base *jsonschema.Schema,
+	depth int,
+) (*TmplObject, error) {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	propSchemas := make(map[string]*jsonschema.Schema, len(schema.Properties))
+	if base != nil {
+		for _, name := range schema.Required {
+			if prop, ok := base.Properties[name]; ok {
+				propSchemas[name] = prop
+			}
+		}
+	}
+	for propName, prop := range schema.Properties {
+		propSchemas[propName] = prop
+	}
+
+	return t.objectFromProperties(
+		propSchemas, required,
+		schema.MinProperties, schema.MaxProperties,
+		depth,
+	)
+}
+
+// objectFromProperties creates a TmplObject with the given property
+// schemas. The required map indicates which properties are required.
+func (t *Template) objectFromProperties(
+	propSchemas map[string]*jsonschema.Schema,
+	required map[string]bool,
+	minProperties, maxProperties int,
+	depth int,
+) (*TmplObject, error) {
+	properties := []*Property{}
+	for propName, prop := range propSchemas {
+		propType, err := t.fromSchema(prop, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, &Property{
+			Name:     propName,
+			Type:     propType,
+			Required: required[propName],
+		})
+	}
+	// Sort properties by name to make the output deterministic
+	slices.SortFunc(properties, func(p1, p2 *Property) int {
+		return cmp.Compare(p1.Name, p2.Name)
+	})
+
+	return &TmplObject{
+		Properties:    properties,
+		MinProperties: minProperties,
+		MaxProperties: maxProperties,
+	}, nil
+}
+
+// additionalFromSchema sets the additional properties of obj if the
+// additionalProperties of the object schema is a schema.
+func (t *Template) additionalFromSchema(
+	obj *TmplObject,
+	schema *jsonschema.Schema,
+	depth int,
+) error {
+	obj.MaxAdditional = 3
+	additional, ok := schema.AdditionalProperties.(*jsonschema.Schema)
+	if !ok {
+		return nil
+	}
+	ty, err := t.fromSchema(additional, depth+1)
+	if err != nil {
+		return err
+	}
+	obj.AdditionalProperties = ty
+	return nil
+}
+
+// mergeAllOf collects the properties and required properties of a
+// schema, the schema it references and the schemas in its allOf,
+// recursively. If a property is defined more than once, the last
+// definition wins, with the schema's own properties coming first and
+// the allOf schemas in their order. Only object schemas are supported.
+func mergeAllOf(
+	schema *jsonschema.Schema,
+) (map[string]*jsonschema.Schema, map[string]bool, error) {
+	propSchemas := make(map[string]*jsonschema.Schema)
+	required := make(map[string]bool)
+	var merge func(*jsonschema.Schema) error
+	merge = func(s *jsonschema.Schema) error {
+		for _, ty := range s.Types {
+			if ty != "object" {
+				return fmt.Errorf(
+					"allOf with type %s not supported at %s", ty, s.Location,
+				)
+			}
+		}
+		maps.Copy(propSchemas, s.Properties)
+		for _, name := range s.Required {
+			required[name] = true
+		}
+		if s.Ref != nil {
+			if err := merge(s.Ref); err != nil {
+				return err
+			}
+		}
+		for _, sub := range s.AllOf {
+			if err := merge(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := merge(schema); err != nil {
+		return nil, nil, err
+	}
+	return propSchemas, required, nil
+}
+
+// conditionalRequiredFromSchema creates a ConditionalGroup for an
+// object schema with an if/then that only makes some of its properties
+// required depending on the constant string values of other
+// properties. The second return value is false for all other schemas.
+func conditionalRequiredFromSchema(
+	schema *jsonschema.Schema,
+) (ConditionalGroup, bool) {
+	cond, then := schema.If, schema.Then
+	if cond == nil || then == nil || schema.Else != nil ||
+		len(cond.Properties) == 0 || len(then.Properties) > 0 ||
+		len(then.Required) == 0 {
+		return ConditionalGroup{}, false
+	}
+	when := make(map[string]string, len(cond.Properties))
+	for name, prop := range cond.Properties {
+		if len(prop.Constant) == 0 {
+			return ConditionalGroup{}, false
+		}
+		value, ok := prop.Constant[0].(string)
+		if !ok {
+			return ConditionalGroup{}, false
+		}
+		when[name] = value
+	}
+	for _, name := range then.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return ConditionalGroup{}, false
+		}
+	}
+	return ConditionalGroup{
+		WhenPropertyIs: when,
+		ThenRequired:   then.Required,
+	}, true
+}
+
+// conditionalFromSchema creates a TmplConditional for an object schema
+// with if/then/else. The object without the conditional parts is
+// registered as a separate type.
+func (t *Template) conditionalFromSchema(
+	name string,
+	schema *jsonschema.Schema,
+	obj *TmplObject,
+	depth int,
+) (*TmplConditional, error) {
+	objName := name + "/object"
+	t.Types[objName] = obj
+
+	branch := func(sub *jsonschema.Schema) ([]string, error) {
+		if sub == nil {
+			return nil, nil
+		}
+		subName := ShortLocation(sub)
+		if _, ok := t.Types[subName]; !ok {
+			t.Types[subName] = nil
+			subObj, err := t.objectFromSchema(sub, schema, depth)
+			if err != nil {
+				return nil, err
+			}
+			t.Types[subName] = subObj
+		}
+		return []string{subName}, nil
+	}
+
+	thenTypes, err := branch(schema.Then)
+	if err != nil {
+		return nil, err
+	}
+	elseTypes, err := branch(schema.Else)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TmplConditional{
+		Condition:       objName,
+		Then:            thenTypes,
+		Else:            elseTypes,
+		CondProbability: 0.5,
+	}, nil
+}
+
+// ratToInt64 converts a rational number to an integer, rounding it
+// with round if it's not an integer already.
+func ratToInt64(r *big.Rat, round func(float64) float64) int64 {
+	if r.IsInt() {
+		return r.Num().Int64()
+	}
+	f, _ := r.Float64()
+	return int64(round(f))
+}
+
+// constValue returns the value of the const keyword of the schema if it
+// has one of the types supported by TmplConst.
+func constValue(schema *jsonschema.Schema) (any, bool) {
+	if len(schema.Constant) == 0 {
+		return nil, false
+	}
+	switch v := schema.Constant[0].(type) {
+	case string, bool:
+		return v, true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
 }
 
 func getType(schema *jsonschema.Schema) (string, *jsonschema.Schema, error) {
+	if _, ok := constValue(schema); ok {
+		return "const", schema, nil
+	}
+	if len(schema.AllOf) > 0 {
+		return "allof", schema, nil
+	}
+	if schema.Ref != nil && hasEnclosingKeywords(schema) {
+		return getType(mergeRefWithEnclosing(schema, schema.Ref))
+	}
 	t, err := getSimpleType(schema.Types)
 	if err != nil {
 		return "", nil, err
@@ -628,16 +2752,114 @@ func getType(schema *jsonschema.Schema) (string, *jsonschema.Schema, error) {
 	if len(schema.OneOf) > 0 {
 		return "oneof", schema, nil
 	}
+	if len(schema.AnyOf) > 0 {
+		return "anyof", schema, nil
+	}
 
 	return "", nil, fmt.Errorf("could not determine type of %s", schema.Location)
 }
 
+// hasEnclosingKeywords returns whether the schema has any of the
+// keywords that mergeRefWithEnclosing takes from the enclosing schema.
+func hasEnclosingKeywords(schema *jsonschema.Schema) bool {
+	return len(schema.Types) > 0 ||
+		schema.Format != "" ||
+		len(schema.Enum) > 0 ||
+		len(schema.Constant) > 0 ||
+		len(schema.Properties) > 0 ||
+		len(schema.Required) > 0 ||
+		schema.AdditionalProperties != nil ||
+		schema.Items2020 != nil ||
+		schema.Pattern != nil ||
+		schema.Minimum != nil ||
+		schema.Maximum != nil ||
+		schema.MinProperties != -1 ||
+		schema.MaxProperties != -1 ||
+		schema.MinItems != -1 ||
+		schema.MaxItems != -1 ||
+		schema.MinLength != -1 ||
+		schema.MaxLength != -1 ||
+		schema.UniqueItems
+}
+
+// mergeRefWithEnclosing returns a schema combining a schema with both
+// $ref and its own keywords, base, with the target of the reference,
+// ref. The keywords given explicitly in base take precedence over those
+// of ref. The properties of both are combined, as are the required
+// properties. The result has the location of base, because it differs
+// from ref, and the reference of ref, so that chains of references are
+// followed.
+func mergeRefWithEnclosing(base, ref *jsonschema.Schema) *jsonschema.Schema {
+	merged := *ref
+	merged.Location = base.Location
+	if len(base.Types) > 0 {
+		merged.Types = base.Types
+	}
+	if base.Format != "" {
+		merged.Format = base.Format
+	}
+	if len(base.Enum) > 0 {
+		merged.Enum = base.Enum
+	}
+	if len(base.Constant) > 0 {
+		merged.Constant = base.Constant
+	}
+	if len(base.Properties) > 0 {
+		merged.Properties = maps.Clone(ref.Properties)
+		if merged.Properties == nil {
+			merged.Properties = make(map[string]*jsonschema.Schema, len(base.Properties))
+		}
+		maps.Copy(merged.Properties, base.Properties)
+	}
+	if len(base.Required) > 0 {
+		merged.Required = slices.Clone(ref.Required)
+		for _, name := range base.Required {
+			if !slices.Contains(merged.Required, name) {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+	}
+	if base.AdditionalProperties != nil {
+		merged.AdditionalProperties = base.AdditionalProperties
+	}
+	if base.Items2020 != nil {
+		merged.Items2020 = base.Items2020
+	}
+	if base.Pattern != nil {
+		merged.Pattern = base.Pattern
+	}
+	if base.Minimum != nil {
+		merged.Minimum = base.Minimum
+	}
+	if base.Maximum != nil {
+		merged.Maximum = base.Maximum
+	}
+	for _, lim := range []struct{ base, merged *int }{
+		{&base.MinProperties, &merged.MinProperties},
+		{&base.MaxProperties, &merged.MaxProperties},
+		{&base.MinItems, &merged.MinItems},
+		{&base.MaxItems, &merged.MaxItems},
+		{&base.MinLength, &merged.MinLength},
+		{&base.MaxLength, &merged.MaxLength},
+	} {
+		if *lim.base != -1 {
+			*lim.merged = *lim.base
+		}
+	}
+	if base.UniqueItems {
+		merged.UniqueItems = true
+	}
+	return &merged
+}
+
+// getSimpleType returns the type given by types, which is "multi" if
+// there are several.
 func getSimpleType(types []string) (string, error) {
 	if len(types) == 0 {
 		return "", nil
 	}
 	if len(types) > 1 {
-		return "", fmt.Errorf("too many types: %v", types)
+		return "multi", nil
 	}
 	return types[0], nil
 }
@@ -645,9 +2867,13 @@ func getSimpleType(types []string) (string, error) {
 func (t *Template) applyCSAFSpecials() error {
 	t.Types[productIDTypeName] = &TmplID{
 		Namespace: productIDNamespace,
+		MinLength: 6,
+		MaxLength: 10,
 	}
 	t.Types[groupIDTypeName] = &TmplID{
 		Namespace: groupIDNamespace,
+		MinLength: 6,
+		MaxLength: 10,
 	}
 
 	var errs []error
@@ -686,6 +2912,16 @@ func (t *Template) applyCSAFSpecials() error {
 		},
 	))
 
+	// The product tree branches are the most deeply nested objects.
+	// Close to the maximum depth, generate only the essential parts.
+	collectErr(t.modifyObject(
+		"csaf:#/$defs/branches_t/items",
+		func(obj *TmplObject) error {
+			obj.Stub = true
+			return nil
+		},
+	))
+
 	return errors.Join(errs...)
 }
 
@@ -698,9 +2934,9 @@ func (t *Template) overwriteType(typename string, tmpl TmplNode) error {
 	return nil
 }
 
-func (t *Template) modifyProperty(
-	typename, propname string,
-	modify func(*Property) error,
+func (t *Template) modifyObject(
+	typename string,
+	modify func(*TmplObject) error,
 ) error {
 	tmpl, ok := t.Types[typename]
 	if !ok {
@@ -710,31 +2946,153 @@ func (t *Template) modifyProperty(
 	if !ok {
 		return fmt.Errorf("type %s is not a TmplObject", typename)
 	}
-	for _, p := range obj.Properties {
-		if p.Name == propname {
-			return modify(p)
+	return modify(obj)
+}
+
+func (t *Template) modifyProperty(
+	typename, propname string,
+	modify func(*Property) error,
+) error {
+	return t.modifyObject(typename, func(obj *TmplObject) error {
+		for _, p := range obj.Properties {
+			if p.Name == propname {
+				return modify(p)
+			}
 		}
+		return fmt.Errorf("type %s has no property %s", typename, propname)
+	})
+}
+
+// tomlTemplate is the raw TOML representation of a template.
+type tomlTemplate struct {
+	Root    string                    `toml:"root"`
+	Types   map[string]toml.Primitive `toml:"types"`
+	Memoize struct {
+		Types []string `toml:"types"`
+	} `toml:"memoize"`
+}
+
+// template converts the raw TOML representation into a Template.
+func (tt *tomlTemplate) template(md toml.MetaData) (*Template, error) {
+	types, err := decodeTypes(md, tt.Types)
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Errorf("type %s has no property %s", typename, propname)
+
+	return &Template{
+		Types:        types,
+		Root:         tt.Root,
+		MemoizeTypes: tt.Memoize.Types,
+	}, nil
 }
 
 // LoadTemplate loads a template from a TOML file.
 func LoadTemplate(file string) (*Template, error) {
-	var template struct {
-		Root  string                    `toml:"root"`
-		Types map[string]toml.Primitive `toml:"types"`
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTemplateFromReader(f)
+}
+
+// LoadTemplateFromReader loads a template in TOML format from r.
+func LoadTemplateFromReader(r io.Reader) (*Template, error) {
+	var tt tomlTemplate
+	md, err := toml.NewDecoder(r).Decode(&tt)
+	if err != nil {
+		return nil, err
 	}
-	md, err := toml.DecodeFile(file, &template)
+	return tt.template(md)
+}
+
+// LoadTemplateFromString is an alias for ParseTemplate, named for
+// symmetry with LoadTemplate and LoadTemplateFromReader.
+func LoadTemplateFromString(s string) (*Template, error) {
+	return ParseTemplate(s)
+}
+
+// LoadTemplateFromJSON loads a template from a JSON file as written by
+// WriteJSON.
+func LoadTemplateFromJSON(file string) (*Template, error) {
+	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return LoadTemplateFromJSONReader(f)
+}
+
+// LoadTemplateFromJSONReader loads a template in JSON format from r.
+// The JSON is converted to TOML first, so that the types are decoded
+// and checked exactly like those of TOML templates.
+func LoadTemplateFromJSONReader(r io.Reader) (*Template, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(jsonToTOML(raw)); err != nil {
+		return nil, err
+	}
+	return LoadTemplateFromReader(&buf)
+}
+
+// jsonToTOML converts a value decoded from JSON with UseNumber so that
+// it can be encoded as TOML without losing the distinction between
+// integers and floats.
+func jsonToTOML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = jsonToTOML(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = jsonToTOML(value)
+		}
+		return v
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
 
-	types, err := decodeTypes(md, template.Types)
+// ParseTemplate parses a template in TOML format. LoadTemplateFromString
+// does the same.
+func ParseTemplate(data string) (*Template, error) {
+	var tt tomlTemplate
+	md, err := toml.Decode(data, &tt)
 	if err != nil {
 		return nil, err
 	}
+	return tt.template(md)
+}
+
+// MustParseTemplate is like ParseTemplate but panics if the template
+// cannot be parsed. It is intended for test setup code with inline
+// templates. Do not use it in production code.
+func MustParseTemplate(data string) *Template {
+	templ, err := ParseTemplate(data)
+	if err != nil {
+		panic(`fakedoc: ParseTemplate: ` + err.Error())
+	}
+	return templ
+}
 
-	return &Template{Types: types, Root: template.Root}, nil
+// ParseTemplateBytes parses a template in TOML format.
+func ParseTemplateBytes(data []byte) (*Template, error) {
+	return ParseTemplate(string(data))
 }
 
 func decodeTypes(
@@ -0,0 +1,1501 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package fakedoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fromTestSchema is FromSchemaBytes for the schemas of the tests, which
+// are not CSAF schemas.
+func fromTestSchema(data []byte, baseURL string, opts ...FromSchemaOption) (*Template, error) {
+	return FromSchemaBytes(data, baseURL, append(opts, WithoutCSAFSpecials())...)
+}
+
+func TestFromSchemaBytes(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"score": {"type": "number", "minimum": 0, "maximum": 10}
+		}
+	}`)
+	const baseURL = "https://example.com/schema.json"
+
+	templ, err := FromSchemaBytes(schema, baseURL, WithoutCSAFSpecials())
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	if templ.Root != baseURL+"#" {
+		t.Errorf("unexpected root type %q", templ.Root)
+	}
+	obj, ok := templ.Types[templ.Root].(*TmplObject)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplObject", templ.Types[templ.Root])
+	}
+	if len(obj.Properties) != 2 {
+		t.Errorf("root object has %d properties, expected 2", len(obj.Properties))
+	}
+
+	// The CSAF specific adjustments are not skipped silently for other
+	// schemas.
+	if _, err := FromSchemaBytes(schema, baseURL); err == nil {
+		t.Error("CSAF specific adjustments applied to a non-CSAF schema")
+	}
+}
+
+func TestFromSchemaRefWithType(t *testing.T) {
+	schema, err := os.ReadFile(filepath.Join("testdata", "ref_with_type.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const baseURL = "https://example.com/schema.json"
+
+	templ, err := fromTestSchema(schema, baseURL)
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	checkProperties := func(name string, want map[string]bool) *TmplObject {
+		t.Helper()
+		obj, ok := templ.Types[baseURL+"#/properties/"+name].(*TmplObject)
+		if !ok {
+			t.Fatalf("%s type is %T, expected *TmplObject",
+				name, templ.Types[baseURL+"#/properties/"+name])
+		}
+		if len(obj.Properties) != len(want) {
+			t.Errorf("%s has %d properties, expected %d",
+				name, len(obj.Properties), len(want))
+		}
+		for _, prop := range obj.Properties {
+			required, ok := want[prop.Name]
+			switch {
+			case !ok:
+				t.Errorf("%s: unexpected property %q", name, prop.Name)
+			case prop.Required != required:
+				t.Errorf("%s: property %q: required is %t, expected %t",
+					name, prop.Name, prop.Required, required)
+			}
+		}
+		return obj
+	}
+
+	person := checkProperties("person", map[string]bool{"age": false, "email": true, "name": true})
+	for _, prop := range person.Properties {
+		if prop.Name != "name" {
+			continue
+		}
+		if str, ok := templ.Types[prop.Type].(*TmplString); !ok || str.MaxLength != 5 {
+			t.Errorf("name does not use the enclosing schema: %#v", templ.Types[prop.Type])
+		}
+	}
+
+	// Keywords other than a type or properties are merged, too.
+	checkProperties("contact", map[string]bool{"age": true, "name": true})
+	if str, ok := templ.Types[baseURL+"#/properties/short"].(*TmplString); !ok ||
+		str.MinLength != 1 || str.MaxLength != 3 {
+		t.Errorf("short does not use the enclosing maxLength: %#v",
+			templ.Types[baseURL+"#/properties/short"])
+	}
+	if str, ok := templ.Types[baseURL+"#/properties/color"].(*TmplString); !ok ||
+		!slices.Equal(str.Enum, []string{"red", "green"}) {
+		t.Errorf("color does not use the enclosing enum: %#v",
+			templ.Types[baseURL+"#/properties/color"])
+	}
+}
+
+func TestFromSchemaCollectErrors(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"ok": {"type": "string"},
+			"boundary": {"type": "string", "pattern": "a\\bx"},
+			"untyped": {}
+		}
+	}`)
+	const baseURL = "https://example.com/broken.json"
+
+	_, err := fromTestSchema(schema, baseURL)
+	if err == nil {
+		t.Fatal("FromSchemaBytes accepted a broken schema")
+	}
+	if strings.Count(err.Error(), "\n") != 0 {
+		t.Errorf("expected a single error without collecting, got %v", err)
+	}
+
+	_, err = fromTestSchema(schema, baseURL, WithCollectErrors())
+	if err == nil {
+		t.Fatal("FromSchemaBytes accepted a broken schema when collecting errors")
+	}
+	for _, want := range []string{"unsupported regexp", "could not determine type"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("collected errors %q do not contain %q", err, want)
+		}
+	}
+}
+
+func TestConditionalRequired(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["category"],
+		"properties": {
+			"category": {"type": "string", "enum": ["vendor_fix", "workaround"]},
+			"url": {"type": "string", "enum": ["https://example.com/"]}
+		},
+		"if": {"properties": {"category": {"const": "vendor_fix"}}},
+		"then": {"required": ["url"]}
+	}`)
+	templ, err := fromTestSchema(schema, "https://example.com/remediation.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	obj, ok := templ.Types[templ.Root].(*TmplObject)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplObject", templ.Types[templ.Root])
+	}
+	want := []ConditionalGroup{{
+		WhenPropertyIs: map[string]string{"category": "vendor_fix"},
+		ThenRequired:   []string{"url"},
+	}}
+	if !reflect.DeepEqual(obj.ConditionalRequired, want) {
+		t.Fatalf("unexpected conditional groups %v", obj.ConditionalRequired)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		m := doc.(map[string]any)
+		if _, hasURL := m["url"]; m["category"] == "vendor_fix" && !hasURL {
+			t.Errorf("conditionally required property missing: %v", m)
+		}
+	}
+}
+
+func TestConditionalFromSchema(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["kind"],
+		"properties": {
+			"kind": {"type": "string", "enum": ["a", "b"]}
+		},
+		"if": {"required": ["extra"]},
+		"then": {
+			"required": ["then"],
+			"properties": {"then": {"type": "string", "enum": ["yes"]}}
+		},
+		"else": {
+			"required": ["else"],
+			"properties": {"else": {"type": "string", "enum": ["no"]}}
+		}
+	}`)
+	templ, err := fromTestSchema(schema, "https://example.com/conditional.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	cond, ok := templ.Types[templ.Root].(*TmplConditional)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplConditional", templ.Types[templ.Root])
+	}
+	if len(cond.Then) != 1 || len(cond.Else) != 1 || cond.CondProbability != 0.5 {
+		t.Fatalf("unexpected conditional %+v", cond)
+	}
+	if _, ok := templ.Types[cond.Condition].(*TmplObject); !ok {
+		t.Errorf("condition type is %T, expected *TmplObject",
+			templ.Types[cond.Condition])
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	seen := make(map[string]bool)
+	for range 20 {
+		doc := MustGenerate(gen).(map[string]any)
+		_, hasThen := doc["then"]
+		_, hasElse := doc["else"]
+		if _, ok := doc["kind"]; !ok || hasThen == hasElse {
+			t.Fatalf("unexpected document %v", doc)
+		}
+		seen["then"] = seen["then"] || hasThen
+		seen["else"] = seen["else"] || hasElse
+	}
+	if !seen["then"] || !seen["else"] {
+		t.Errorf("only one branch generated: %v", seen)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	const data = `
+root = "doc"
+
+[types.doc]
+type = "conditional"
+condition = "base"
+then = ["yes"]
+else = ["no"]
+condprobability = %s
+
+[types.base]
+type = "object"
+
+[[types.base.properties]]
+name = "base"
+type = "value"
+required = true
+
+[types.yes]
+type = "object"
+
+[[types.yes.properties]]
+name = "yes"
+type = "value"
+required = true
+
+[types.no]
+type = "object"
+
+[[types.no.properties]]
+name = "no"
+type = "value"
+required = true
+
+[types.value]
+type = "const"
+value = "x"
+`
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		probability string
+		want        []string
+	}{
+		{"1.0", []string{"base", "yes"}},
+		{"0.0", []string{"base", "no"}},
+	} {
+		templ := MustParseTemplate(fmt.Sprintf(data, tc.probability))
+		gen := NewGenerator(templ, WithRand(rng))
+		for range 5 {
+			doc := MustGenerate(gen).(map[string]any)
+			if keys := slices.Sorted(maps.Keys(doc)); !slices.Equal(keys, tc.want) {
+				t.Errorf("condprobability %s: got properties %v, expected %v",
+					tc.probability, keys, tc.want)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := templ.Write(&buf); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		loaded, err := LoadTemplateFromReader(&buf)
+		if err != nil {
+			t.Fatalf("LoadTemplateFromReader failed: %v", err)
+		}
+		if !reflect.DeepEqual(loaded.Types["doc"], templ.Types["doc"]) {
+			t.Errorf("reloaded conditional is %+v, expected %+v",
+				loaded.Types["doc"], templ.Types["doc"])
+		}
+	}
+
+	if _, err := ParseTemplate(fmt.Sprintf(data, "1.5")); err == nil {
+		t.Error("ParseTemplate accepted condprobability 1.5")
+	}
+
+	nonObject := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "conditional"
+condition = "value"
+
+[types.value]
+type = "const"
+value = "x"
+`)
+	if _, err := NewGenerator(nonObject, WithRand(rng)).Generate(); err == nil {
+		t.Error("Generate accepted a condition type that isn't an object")
+	}
+}
+
+func TestIntegerFromSchema(t *testing.T) {
+	templ, err := fromTestSchema(
+		[]byte(`{"type": "integer", "minimum": 0.5, "maximum": 10}`),
+		"https://example.com/integer.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	integer, ok := templ.Types[templ.Root].(*TmplInteger)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplInteger", templ.Types[templ.Root])
+	}
+	if *integer.Minimum != 1 || *integer.Maximum != 10 {
+		t.Errorf("range is %d..%d, expected 1..10", *integer.Minimum, *integer.Maximum)
+	}
+
+	if _, err := ParseTemplate(`
+[types.count]
+type = "integer"
+minimum = 5
+maximum = 1
+`); err == nil {
+		t.Error("ParseTemplate accepted minimum > maximum")
+	}
+}
+
+func TestNullableFromSchema(t *testing.T) {
+	templ, err := fromTestSchema(
+		[]byte(`{"type": ["string", "null"], "enum": ["x", null]}`),
+		"https://example.com/nullable.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	oneof, ok := templ.Types[templ.Root].(*TmplOneOf)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplOneOf", templ.Types[templ.Root])
+	}
+	if len(oneof.OneOf) != 2 {
+		t.Fatalf("unexpected alternatives %v", oneof.OneOf)
+	}
+	if _, ok := templ.Types[oneof.OneOf[1]].(*TmplNull); !ok {
+		t.Errorf("second alternative is %T, expected *TmplNull", templ.Types[oneof.OneOf[1]])
+	}
+
+	// The null type must survive writing and loading the template.
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	if _, ok := loaded.Types[oneof.OneOf[1]].(*TmplNull); !ok {
+		t.Errorf("loaded null type is %T", loaded.Types[oneof.OneOf[1]])
+	}
+}
+
+func TestConstRoundTrip(t *testing.T) {
+	values := map[string]any{
+		"string": "fixed",
+		"int":    int64(42),
+		"float":  2.5,
+		"bool":   true,
+	}
+	templ := &Template{Root: "string", Types: map[string]TmplNode{}}
+	for name, value := range values {
+		templ.Types[name] = &TmplConst{Value: value}
+	}
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	for name, value := range values {
+		c, ok := loaded.Types[name].(*TmplConst)
+		if !ok {
+			t.Errorf("%s: type is %T, expected *TmplConst", name, loaded.Types[name])
+			continue
+		}
+		if c.Value != value {
+			t.Errorf("%s: value is %#v, expected %#v", name, c.Value, value)
+		}
+	}
+
+	if _, err := ParseTemplate(`
+[types.c]
+type = "const"
+value = [1, 2]
+`); err == nil {
+		t.Error("ParseTemplate accepted an array value")
+	}
+}
+
+func TestConstFromSchema(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"status": {"type": "string", "const": "final"},
+			"version": {"const": 2}
+		}
+	}`), "https://example.com/const.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	for _, prop := range templ.Types[templ.Root].(*TmplObject).Properties {
+		want := map[string]any{"status": "final", "version": int64(2)}[prop.Name]
+		c, ok := templ.Types[prop.Type].(*TmplConst)
+		if !ok || c.Value != want {
+			t.Errorf("%s: unexpected type %#v", prop.Name, templ.Types[prop.Type])
+		}
+	}
+}
+
+func TestAllOfFromSchema(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{
+		"allOf": [
+			{"$ref": "#/$defs/base"},
+			{
+				"allOf": [
+					{
+						"required": ["score"],
+						"properties": {"score": {"type": "number"}}
+					},
+					{"properties": {"comment": {"type": "string"}}}
+				]
+			}
+		],
+		"$defs": {
+			"base": {
+				"type": "object",
+				"required": ["version"],
+				"properties": {
+					"version": {"type": "string", "enum": ["3.1"]},
+					"comment": {"type": "integer"}
+				}
+			}
+		}
+	}`), "https://example.com/allof.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	obj, ok := templ.Types[templ.Root].(*TmplObject)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplObject", templ.Types[templ.Root])
+	}
+	got := make(map[string]bool)
+	for _, prop := range obj.Properties {
+		got[prop.Name] = prop.Required
+		if prop.Name == "comment" {
+			if _, ok := templ.Types[prop.Type].(*TmplString); !ok {
+				t.Errorf("comment type is %T, expected the last definition",
+					templ.Types[prop.Type])
+			}
+		}
+	}
+	want := map[string]bool{"version": true, "score": true, "comment": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("properties %v, expected %v", got, want)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 10 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		m := doc.(map[string]any)
+		if _, ok := m["version"]; !ok {
+			t.Errorf("required property version missing: %v", m)
+		}
+		if _, ok := m["score"]; !ok {
+			t.Errorf("required property score missing: %v", m)
+		}
+	}
+}
+
+func TestAnyOfFromSchema(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{
+		"anyOf": [
+			{"type": "string", "enum": ["a"]},
+			{"type": "number", "minimum": 1, "maximum": 2}
+		]
+	}`), "https://example.com/anyof.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	root, ok := loaded.Types[loaded.Root].(*TmplOneOf)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplOneOf", loaded.Types[loaded.Root])
+	}
+	if !root.AnyOf {
+		t.Error("anyOf origin lost in round trip")
+	}
+	oneof, err := fromTestSchema([]byte(`{
+		"oneOf": [{"type": "string"}, {"type": "number"}]
+	}`), "https://example.com/oneof.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	if oneof.Types[oneof.Root].(*TmplOneOf).AnyOf {
+		t.Error("oneOf marked as anyOf")
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	for range 20 {
+		value, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		switch v := value.(type) {
+		case string:
+			if v != "a" {
+				t.Errorf("unexpected string %q", v)
+			}
+		case float32:
+			if v < 1 || v > 2 {
+				t.Errorf("number %g out of range", v)
+			}
+		default:
+			t.Errorf("value %v has unexpected type %T", v, v)
+		}
+	}
+}
+
+func TestAdditionalProperties(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"name": {"type": "string", "enum": ["n"]}},
+		"additionalProperties": {"type": "string", "enum": ["extra"]}
+	}`), "https://example.com/additional.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	obj := templ.Types[templ.Root].(*TmplObject)
+	if obj.AdditionalProperties == "" || obj.MaxAdditional != 3 {
+		t.Fatalf("unexpected additional properties %q, max %d",
+			obj.AdditionalProperties, obj.MaxAdditional)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	var maxSeen int
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		m := doc.(map[string]any)
+		for name, value := range m {
+			if name != "name" && value != "extra" {
+				t.Errorf("unexpected additional property %q: %v", name, value)
+			}
+		}
+		maxSeen = max(maxSeen, len(m)-1)
+	}
+	if maxSeen == 0 || maxSeen > 3 {
+		t.Errorf("at most %d additional properties, expected 1 to 3", maxSeen)
+	}
+}
+
+// nestedSchema returns a schema with levels nested objects, each of
+// which is defined in $defs and referenced with $ref from the
+// previous level.
+func nestedSchema(levels int) []byte {
+	var defs []string
+	for i := range levels {
+		defs = append(defs, fmt.Sprintf(
+			`"level%d": {"type": "object", "properties": {"next": {"$ref": "#/$defs/level%d"}}}`,
+			i, i+1,
+		))
+	}
+	defs = append(defs, fmt.Sprintf(`"level%d": {"type": "string"}`, levels))
+	return []byte(fmt.Sprintf(
+		`{"$ref": "#/$defs/level0", "$defs": {%s}}`,
+		strings.Join(defs, ","),
+	))
+}
+
+func TestFromSchemaDepthLimit(t *testing.T) {
+	const baseURL = "https://example.com/nested.json"
+
+	if _, err := fromTestSchema(nestedSchema(100), baseURL); err != nil {
+		t.Errorf("FromSchemaBytes failed for 100 levels: %v", err)
+	}
+
+	_, err := fromTestSchema(nestedSchema(201), baseURL)
+	if err == nil || !strings.Contains(err.Error(), "too deeply nested") {
+		t.Errorf("expected nesting error for 201 levels, got %v", err)
+	}
+}
+
+func TestLoadSchemaFromFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.json": `{
+			"type": "object",
+			"required": ["person"],
+			"properties": {"person": {"$ref": "./common.json#/$defs/person"}}
+		}`,
+		"common.json": `{
+			"$defs": {"person": {"type": "object", "properties": {"name": {"type": "string"}}}}
+		}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schema, err := LoadSchemaFromFile(filepath.Join(dir, "main.json"))
+	if err != nil {
+		t.Fatalf("LoadSchemaFromFile failed: %v", err)
+	}
+	templ, err := FromSchema(schema, WithoutCSAFSpecials())
+	if err != nil {
+		t.Fatalf("FromSchema failed: %v", err)
+	}
+	root, ok := templ.Types[templ.Root].(*TmplObject)
+	if !ok || len(root.Properties) != 1 {
+		t.Fatalf("unexpected root type %#v", templ.Types[templ.Root])
+	}
+	if _, ok := templ.Types[root.Properties[0].Type].(*TmplObject); !ok {
+		t.Errorf("referenced type %q is not an object", root.Properties[0].Type)
+	}
+}
+
+func TestCleanWhitespace(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+		trim, collapse  bool
+	}{
+		{" a  b ", " a  b ", false, false},
+		{" a  b ", "a  b", true, false},
+		{" a  b ", "a b", false, true},
+		{"a\n\nb  ", "a b", true, true},
+	} {
+		got := cleanWhitespace(test.input, test.trim, test.collapse)
+		if got != test.expected {
+			t.Errorf("cleanWhitespace(%q, %t, %t) = %q, expected %q",
+				test.input, test.trim, test.collapse, got, test.expected)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	const data = `
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+required = true
+
+[types.title]
+type = "lorem"
+minlength = 2
+maxlength = 4
+`
+	templ, err := ParseTemplate(data)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	if templ.Root != "doc" {
+		t.Errorf("unexpected root type %q", templ.Root)
+	}
+	obj, ok := templ.Types["doc"].(*TmplObject)
+	if !ok {
+		t.Fatalf("doc type is %T, expected *TmplObject", templ.Types["doc"])
+	}
+	if len(obj.Properties) != 1 || obj.Properties[0].Name != "title" {
+		t.Errorf("unexpected properties of doc type: %v", obj.Properties)
+	}
+	lorem, ok := templ.Types["title"].(*TmplLorem)
+	if !ok {
+		t.Fatalf("title type is %T, expected *TmplLorem", templ.Types["title"])
+	}
+	if lorem.MinLength != 2 || lorem.MaxLength != 4 {
+		t.Errorf("title length is %d..%d, expected 2..4",
+			lorem.MinLength, lorem.MaxLength)
+	}
+
+	if _, err := ParseTemplateBytes([]byte(`[types.x]
+type = "unknown"`)); err == nil {
+		t.Error("ParseTemplateBytes accepted an unknown type kind")
+	}
+}
+
+func TestMergePropertyTypes(t *testing.T) {
+	base := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+
+[[types.doc.properties]]
+name = "summary"
+type = "title"
+`)
+	overrides := MustParseTemplate(`
+[types.doc]
+type = "object"
+
+[types.doc.propertytypes]
+summary = "summary"
+`)
+	if err := base.MergeDeep(overrides); err != nil {
+		t.Fatalf("MergeDeep failed: %v", err)
+	}
+	var types []string
+	for _, p := range base.Types["doc"].(*TmplObject).Properties {
+		types = append(types, p.Type)
+	}
+	if !slices.Equal(types, []string{"title", "summary"}) {
+		t.Errorf("unexpected property types %v", types)
+	}
+
+	bad := MustParseTemplate(`
+[types.doc]
+type = "object"
+
+[types.doc.propertytypes]
+unknown = "summary"
+`)
+	if err := base.MergeDeep(bad); err == nil {
+		t.Error("MergeDeep accepted an override for an unknown property")
+	}
+	if props := overrides.Types["doc"].(*TmplObject).Properties; len(props) != 0 {
+		t.Errorf("MergeDeep modified the overrides: %v", props)
+	}
+}
+
+func TestMergePropertyFilter(t *testing.T) {
+	base := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+required = true
+
+[[types.doc.properties]]
+name = "summary"
+type = "title"
+required = true
+
+[types.title]
+type = "string"
+enum = ["x"]
+`)
+	overrides := MustParseTemplate(`
+[types.doc]
+type = "object"
+propertyfilter = ["summary"]
+`)
+	if err := base.MergeDeep(overrides); err != nil {
+		t.Fatalf("MergeDeep failed: %v", err)
+	}
+	errs := base.Validate()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrFilteredRequired) {
+		t.Errorf("Validate: got %v, want filtered required property", errs)
+	}
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewGenerator(base, WithRand(rng)).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := doc.(map[string]any)["summary"]; ok || len(doc.(map[string]any)) != 1 {
+		t.Errorf("unexpected document %v", doc)
+	}
+}
+
+func TestMergeExcludeProperties(t *testing.T) {
+	base := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+required = true
+
+[[types.doc.properties]]
+name = "summary"
+type = "title"
+required = true
+
+[[types.doc.properties]]
+name = "notes"
+type = "title"
+
+[types.title]
+type = "string"
+enum = ["x"]
+`)
+	overrides := MustParseTemplate(`
+[types.doc]
+type = "object"
+excludeproperties = ["summary", "notes"]
+`)
+	if err := base.MergeDeep(overrides); err != nil {
+		t.Fatalf("MergeDeep failed: %v", err)
+	}
+	errs := base.Validate()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrFilteredRequired) ||
+		!strings.Contains(errs[0].Error(), "summary") {
+		t.Errorf("Validate: got %v, want excluded required property summary", errs)
+	}
+
+	var buf bytes.Buffer
+	if err := base.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	if got := loaded.Types["doc"].(*TmplObject).ExcludeProperties; !slices.Equal(got, []string{"summary", "notes"}) {
+		t.Errorf("loaded excluded properties %v", got)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	for range 20 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if want := map[string]any{"title": "x"}; !reflect.DeepEqual(doc, want) {
+			t.Fatalf("got %v, want %v", doc, want)
+		}
+	}
+}
+
+func TestMergeDeep(t *testing.T) {
+	base := &Template{
+		Root:  "doc",
+		Types: map[string]TmplNode{"doc": &TmplObject{MinProperties: -1, MaxProperties: -1}},
+	}
+	for i := range 20 {
+		obj := base.Types["doc"].(*TmplObject)
+		obj.Properties = append(obj.Properties, &Property{
+			Name: fmt.Sprintf("p%02d", i),
+			Type: "base",
+		})
+	}
+	overrides := MustParseTemplate(`
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "p07"
+type = "override"
+required = true
+
+[[types.doc.properties]]
+name = "extra"
+type = "override"
+`)
+	if err := base.MergeDeep(overrides); err != nil {
+		t.Fatalf("MergeDeep failed: %v", err)
+	}
+	props := base.Types["doc"].(*TmplObject).Properties
+	if len(props) != 21 {
+		t.Fatalf("merged object has %d properties, expected 21", len(props))
+	}
+	for i, p := range props[:20] {
+		want := Property{Name: fmt.Sprintf("p%02d", i), Type: "base"}
+		if i == 7 {
+			want = Property{Name: "p07", Type: "override", Required: true}
+		}
+		if *p != want {
+			t.Errorf("property %d is %+v, expected %+v", i, *p, want)
+		}
+	}
+	if props[20].Name != "extra" {
+		t.Errorf("unexpected last property %+v", *props[20])
+	}
+	if n := len(overrides.Types["doc"].(*TmplObject).Properties); n != 2 {
+		t.Errorf("MergeDeep modified the overrides, which have %d properties", n)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	const baseTOML = `
+root = "doc"
+
+[memoize]
+types = ["title"]
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "title"
+type = "title"
+
+[types.title]
+type = "string"
+`
+	overrides := MustParseTemplate(`
+[memoize]
+types = ["title", "doc"]
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "summary"
+type = "title"
+
+[types.doc.propertytypes]
+summary = "summary"
+
+[types.summary]
+type = "string"
+
+[types.other]
+type = "object"
+
+[types.other.propertytypes]
+name = "title"
+`)
+	if err := MustParseTemplate(baseTOML).MergeDeep(overrides); err == nil {
+		t.Error("MergeDeep accepted property types without properties")
+	}
+	base := MustParseTemplate(baseTOML)
+	base.Merge(overrides)
+	var props []string
+	for _, p := range base.Types["doc"].(*TmplObject).Properties {
+		props = append(props, p.Name+":"+p.Type)
+	}
+	if !slices.Equal(props, []string{"title:title", "summary:summary"}) {
+		t.Errorf("object not merged, properties %v", props)
+	}
+	if _, ok := base.Types["title"]; !ok {
+		t.Error("Merge removed type title")
+	}
+	if !slices.Equal(base.MemoizeTypes, []string{"title", "doc"}) {
+		t.Errorf("unexpected memoized types %v", base.MemoizeTypes)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := templ.Validate(); len(errs) > 0 {
+		t.Errorf("CSAF template invalid: %v", errs)
+	}
+
+	broken := MustParseTemplate(`
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "items"
+type = "list"
+
+[[types.doc.properties]]
+name = "missing"
+type = "nowhere"
+
+[types.list]
+type = "array"
+items = "choice"
+
+[types.choice]
+type = "oneof"
+oneof = ["ref", "gone"]
+
+[types.ref]
+type = "ref"
+namespace = "product"
+`)
+	errs := broken.Validate()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+	for i, want := range []string{"gone", "nowhere", "namespace product"} {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %q does not mention %q", errs[i], want)
+		}
+	}
+
+	if _, err := NewGenerator(broken).Generate(); err == nil {
+		t.Error("Generate accepted an invalid template")
+	}
+}
+
+func TestFromSchemaContains(t *testing.T) {
+	schema := []byte(`{
+		"type": "array",
+		"items": {"type": "string", "minLength": 2, "maxLength": 5},
+		"contains": {"type": "string", "enum": ["needle"]},
+		"minItems": 1,
+		"maxItems": 3
+	}`)
+	templ, err := fromTestSchema(schema, "https://example.com/contains.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	arr, ok := templ.Types[templ.Root].(*TmplArray)
+	if !ok {
+		t.Fatalf("root type is %T, expected *TmplArray", templ.Types[templ.Root])
+	}
+	if arr.Contains == "" {
+		t.Fatal("contains keyword was ignored")
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 10 {
+		doc, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		items := doc.([]any)
+		if len(items) < 1 || len(items) > 3 {
+			t.Errorf("array has %d items, expected 1 to 3", len(items))
+		}
+		if !slices.Contains(items, any("needle")) {
+			t.Errorf("array %v does not contain the required item", items)
+		}
+	}
+}
+
+func TestOneOfExcludeAtDepth(t *testing.T) {
+	oneof := &TmplOneOf{
+		OneOf:          []string{"simple", "nested"},
+		MinBranches:    1,
+		MaxBranches:    1,
+		ExcludeAtDepth: map[string]int{"nested": 10},
+	}
+	if got := oneof.eligible(5); !slices.Equal(got, []string{"simple"}) {
+		t.Errorf("eligible(5) = %v, expected [simple]", got)
+	}
+	if got := oneof.eligible(10); !slices.Equal(got, oneof.OneOf) {
+		t.Errorf("eligible(10) = %v, expected %v", got, oneof.OneOf)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatalf("FromCSAFSchema failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := templ.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromJSONReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromJSONReader failed: %v", err)
+	}
+
+	generate := func(templ *Template) string {
+		rng, err := ParseSeed("pcg:1:2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := NewGenerator(templ, WithRand(rng)).Generate()
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		out, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	if want, got := generate(templ), generate(loaded); got != want {
+		t.Errorf("reloaded template generated a different document:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestJSONRoundTripFloats(t *testing.T) {
+	values := map[string]any{
+		"float":    2.0,
+		"fraction": 2.5,
+		"large":    1e21,
+		"int":      int64(2),
+	}
+	templ := &Template{Types: make(map[string]TmplNode)}
+	for name, value := range values {
+		templ.Types[name] = &TmplConst{Value: value}
+	}
+	templ.Types["choice"] = &TmplWeightedOneOf{Choices: []WeightedChoice{
+		{Type: "float", Weight: 3.0},
+		{Type: "int", Weight: 0.5},
+	}}
+	var buf bytes.Buffer
+	if err := templ.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromJSONReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromJSONReader failed: %v", err)
+	}
+	for name, want := range values {
+		if value := loaded.Types[name].(*TmplConst).Value; value != want {
+			t.Errorf("%s: reloaded value is %#v, expected %#v", name, value, want)
+		}
+	}
+	if choices := loaded.Types["choice"].(*TmplWeightedOneOf).Choices; !slices.Equal(
+		choices, templ.Types["choice"].(*TmplWeightedOneOf).Choices,
+	) {
+		t.Errorf("unexpected choices %v", choices)
+	}
+}
+
+func TestIPv4(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{
+		"type": "object",
+		"required": ["public", "private"],
+		"properties": {
+			"public": {"type": "string", "format": "ipv4"},
+			"private": {"type": "string", "format": "ipv4"}
+		}
+	}`), "https://example.com/ipv4.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	for _, prop := range templ.Types[templ.Root].(*TmplObject).Properties {
+		ipv4, ok := templ.Types[prop.Type].(*TmplIPv4)
+		if !ok {
+			t.Fatalf("%s: type is %T, expected *TmplIPv4", prop.Name, templ.Types[prop.Type])
+		}
+		ipv4.Private = prop.Name == "private"
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	for range 100 {
+		var doc map[string]string
+		if err := json.Unmarshal(MustGenerateJSON(gen, false), &doc); err != nil {
+			t.Fatal(err)
+		}
+		for name, addr := range doc {
+			ip := net.ParseIP(addr)
+			if ip == nil || ip.To4() == nil {
+				t.Fatalf("%s: %q is not an IPv4 address", name, addr)
+			}
+			if name == "private" && !ip.IsPrivate() {
+				t.Errorf("%q is not a private address", addr)
+			}
+		}
+	}
+}
+
+func TestCVE(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatalf("FromCSAFSchema failed: %v", err)
+	}
+	const cveType = "csaf:#/properties/vulnerabilities/items/properties/cve"
+	if _, ok := templ.Types[cveType].(*TmplCVE); !ok {
+		t.Errorf("CVE type is %T, expected *TmplCVE", templ.Types[cveType])
+	}
+
+	templ, err = ParseTemplate(`
+root = "cve"
+
+[types.cve]
+type = "cve"
+yearmin = 2020
+idmax = 20
+`)
+	if err != nil {
+		t.Fatalf("ParseTemplate failed: %v", err)
+	}
+	cve := templ.Types["cve"].(*TmplCVE)
+	if *cve != (TmplCVE{YearMin: 2020, YearMax: 2025, IDMin: 1, IDMax: 20}) {
+		t.Errorf("unexpected type %+v", cve)
+	}
+
+	pattern := regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(templ, WithRand(rng))
+	for range 1000 {
+		id := MustGenerate(gen).(string)
+		if !pattern.MatchString(id) {
+			t.Fatalf("%q is not a CVE ID", id)
+		}
+		if year, _ := strconv.Atoi(id[4:8]); year < 2020 || year > 2025 {
+			t.Fatalf("%q: year not in range 2020..2025", id)
+		}
+	}
+
+	if _, err := ParseTemplate(`
+[types.cve]
+type = "cve"
+idmin = 10
+idmax = 5
+`); err == nil {
+		t.Error("ParseTemplate accepted an empty id range")
+	}
+
+	// The zero value uses the default ranges and invalid ranges are
+	// reported instead of causing a panic.
+	zero := NewGenerator(&Template{
+		Root:  "cve",
+		Types: map[string]TmplNode{"cve": &TmplCVE{}},
+	}, WithRand(rng))
+	id := MustGenerate(zero).(string)
+	if year, _ := strconv.Atoi(id[4:8]); !pattern.MatchString(id) || year < 1999 {
+		t.Errorf("zero value generated %q", id)
+	}
+	reversed := NewGenerator(&Template{
+		Root:  "cve",
+		Types: map[string]TmplNode{"cve": &TmplCVE{YearMin: 2025, YearMax: 2020}},
+	}, WithRand(rng))
+	if _, err := reversed.Generate(); err == nil {
+		t.Error("Generate accepted a reversed year range")
+	}
+}
+
+func TestEmail(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{"type": "string", "format": "email"}`),
+		"https://example.com/email.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	if _, ok := templ.Types[templ.Root].(*TmplEmail); !ok {
+		t.Fatalf("root type is %T, expected *TmplEmail", templ.Types[templ.Root])
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	if _, ok := loaded.Types[loaded.Root].(*TmplEmail); !ok {
+		t.Fatalf("reloaded root type is %T, expected *TmplEmail", loaded.Types[loaded.Root])
+	}
+
+	pattern := regexp.MustCompile(`.+@.+\..+`)
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	for range 100 {
+		if email := MustGenerate(gen).(string); !pattern.MatchString(email) {
+			t.Fatalf("%q is not an email address", email)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	templ, err := fromTestSchema([]byte(`{"type": "string", "format": "date"}`),
+		"https://example.com/date.json")
+	if err != nil {
+		t.Fatalf("FromSchemaBytes failed: %v", err)
+	}
+	if _, ok := templ.Types[templ.Root].(*TmplDate); !ok {
+		t.Fatalf("root type is %T, expected *TmplDate", templ.Types[templ.Root])
+	}
+
+	mindate := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	maxdate := time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC)
+	templ.Types[templ.Root] = &TmplDate{Minimum: &mindate, Maximum: &maxdate}
+	var buf bytes.Buffer
+	if err := templ.Write(&buf); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	loaded, err := LoadTemplateFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	date, ok := loaded.Types[loaded.Root].(*TmplDate)
+	if !ok || !date.Minimum.Equal(mindate) || !date.Maximum.Equal(maxdate) {
+		t.Fatalf("unexpected reloaded type %#v", loaded.Types[loaded.Root])
+	}
+
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(loaded, WithRand(rng))
+	for range 100 {
+		s := MustGenerate(gen).(string)
+		value, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatalf("%q is not a date: %v", s, err)
+		}
+		if value.Before(mindate) || value.After(maxdate) {
+			t.Fatalf("%s not in range %s..%s", s,
+				mindate.Format(time.DateOnly), maxdate.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestDateTimeFormat(t *testing.T) {
+	rng, err := ParseSeed("pcg:1:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04:05", "02.01.2006 15:04"} {
+		templ, err := ParseTemplate(`
+root = "when"
+
+[types.when]
+type = "date-time"
+format = "` + layout + `"
+`)
+		if err != nil {
+			t.Fatalf("format %q: ParseTemplate failed: %v", layout, err)
+		}
+		gen := NewGenerator(templ, WithRand(rng))
+		for range 20 {
+			s := MustGenerate(gen).(string)
+			if _, err := time.Parse(layout, s); err != nil {
+				t.Fatalf("%q does not match format %q: %v", s, layout, err)
+			}
+		}
+	}
+
+	if _, err := ParseTemplate(`
+[types.when]
+type = "date-time"
+format = "no date"
+`); err == nil {
+		t.Error("ParseTemplate accepted a format without date or time elements")
+	}
+}
+
+func TestLoadTemplateFromReader(t *testing.T) {
+	const data = `
+root = "doc"
+
+[types.doc]
+type = "object"
+
+[[types.doc.properties]]
+name = "id"
+type = "id"
+required = true
+
+[types.id]
+type = "string"
+pattern = "^[A-Z]{4}-[0-9]{3}$"
+`
+	file := filepath.Join(t.TempDir(), "template.toml")
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := LoadTemplate(file)
+	if err != nil {
+		t.Fatalf("LoadTemplate failed: %v", err)
+	}
+	fromReader, err := LoadTemplateFromReader(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadTemplateFromReader failed: %v", err)
+	}
+	fromString, err := LoadTemplateFromString(data)
+	if err != nil {
+		t.Fatalf("LoadTemplateFromString failed: %v", err)
+	}
+	if !reflect.DeepEqual(fromReader, fromFile) {
+		t.Errorf("template loaded from reader differs from the one loaded from file")
+	}
+	if !reflect.DeepEqual(fromString, fromFile) {
+		t.Errorf("template loaded from string differs from the one loaded from file")
+	}
+}
+
+func TestListTypes(t *testing.T) {
+	templ, err := FromCSAFSchema()
+	if err != nil {
+		t.Fatalf("FromCSAFSchema failed: %v", err)
+	}
+	infos := templ.ListTypes()
+	if len(infos) != len(templ.Types) {
+		t.Errorf("ListTypes returned %d types, expected %d", len(infos), len(templ.Types))
+	}
+	if !slices.IsSortedFunc(infos, func(a, b TypeInfo) int { return strings.Compare(a.Name, b.Name) }) {
+		t.Error("types are not sorted by name")
+	}
+	for _, want := range []TypeInfo{
+		{Name: "csaf:#/$defs/full_product_name_t", Kind: "object"},
+		{Name: productIDTypeName, Kind: "id"},
+		{Name: groupIDTypeName, Kind: "id"},
+	} {
+		if !slices.Contains(infos, want) {
+			t.Errorf("%+v not listed", want)
+		}
+	}
+}
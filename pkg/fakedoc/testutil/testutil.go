@@ -0,0 +1,169 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+// Package testutil contains helpers for tests that use fakedoc to
+// generate CSAF documents.
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gocsaf/fakedoc/pkg/fakedoc"
+)
+
+// DefaultSeed is the seed used by NewTestGenerator unless another seed
+// is given with WithSeed.
+const DefaultSeed = "pcg:0:1"
+
+type config struct {
+	template *fakedoc.Template
+	limits   *fakedoc.Limits
+	seed     string
+}
+
+// Option configures the generator created by NewTestGenerator.
+type Option func(*config)
+
+// WithTemplate sets the template of the generator. By default the
+// template derived from the CSAF schema is used.
+func WithTemplate(tmpl *fakedoc.Template) Option {
+	return func(c *config) {
+		c.template = tmpl
+	}
+}
+
+// WithLimits sets the limits of the generator.
+func WithLimits(limits *fakedoc.Limits) Option {
+	return func(c *config) {
+		c.limits = limits
+	}
+}
+
+// WithSeed sets the seed of the generator in the format accepted by
+// fakedoc.ParseSeed.
+func WithSeed(seed string) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// NewTestGenerator creates a generator with a fixed seed so that tests
+// are reproducible. Errors are reported with t.Fatal.
+func NewTestGenerator(t testing.TB, opts ...Option) *fakedoc.Generator {
+	t.Helper()
+
+	c := config{seed: DefaultSeed}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.template == nil {
+		tmpl, err := fakedoc.FromCSAFSchema()
+		if err != nil {
+			t.Fatalf("creating template: %v", err)
+		}
+		c.template = tmpl
+	}
+
+	rng, err := fakedoc.ParseSeed(c.seed)
+	if err != nil {
+		t.Fatalf("parsing seed: %v", err)
+	}
+
+	return fakedoc.NewGenerator(
+		c.template,
+		fakedoc.WithLimits(c.limits),
+		fakedoc.WithRand(rng),
+	)
+}
+
+// GenerateJSON generates a document and returns it as JSON. Errors are
+// reported with t.Fatal.
+func GenerateJSON(t testing.TB, gen *fakedoc.Generator) []byte {
+	t.Helper()
+
+	doc, err := gen.Generate()
+	if err != nil {
+		t.Fatalf("generating document: %v", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("encoding document: %v", err)
+	}
+	return data
+}
+
+// AssertJSONPath checks that the value at the JSON pointer path (RFC
+// 6901) in the JSON document doc equals expectedValue. String values
+// are compared directly, all other values are compared in their JSON
+// encoding, e.g. "42", "true" or "null". Failures are reported with
+// t.Error.
+func AssertJSONPath(t testing.TB, doc []byte, path, expectedValue string) {
+	t.Helper()
+
+	var decoded any
+	if err := json.Unmarshal(doc, &decoded); err != nil {
+		t.Errorf("decoding document: %v", err)
+		return
+	}
+	value, err := resolvePointer(decoded, path)
+	if err != nil {
+		t.Errorf("resolving %q: %v", path, err)
+		return
+	}
+
+	actual, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Errorf("encoding value at %q: %v", path, err)
+			return
+		}
+		actual = string(encoded)
+	}
+	if actual != expectedValue {
+		t.Errorf("value at %q is %q, expected %q", path, actual, expectedValue)
+	}
+}
+
+// resolvePointer returns the value the JSON pointer refers to in the
+// decoded JSON value doc.
+func resolvePointer(doc any, pointer string) (any, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer does not start with '/'")
+	}
+
+	value := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := value.(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("no property %q", token)
+			}
+			value = child
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("invalid array index %q", token)
+			}
+			value = v[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %T with %q", value, token)
+		}
+	}
+	return value, nil
+}
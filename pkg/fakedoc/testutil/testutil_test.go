@@ -0,0 +1,47 @@
+// This file is Free Software under the Apache-2.0 License
+// without warranty, see README.md and LICENSES/Apache-2.0.txt for details.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// SPDX-FileCopyrightText: 2024 German Federal Office for Information Security (BSI) <https://www.bsi.bund.de>
+// Software-Engineering: 2024 Intevation GmbH <https://intevation.de>
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/gocsaf/fakedoc/pkg/fakedoc"
+)
+
+func TestGenerateWithTemplate(t *testing.T) {
+	tmpl := &fakedoc.Template{
+		Root: "doc",
+		Types: map[string]fakedoc.TmplNode{
+			"doc": &fakedoc.TmplObject{
+				Properties: []*fakedoc.Property{
+					{Name: "a/b", Type: "list", Required: true},
+				},
+				MinProperties: -1,
+				MaxProperties: -1,
+			},
+			"list": &fakedoc.TmplArray{
+				Items:    "vendor",
+				MinItems: 2,
+				MaxItems: 2,
+			},
+			"vendor": &fakedoc.TmplString{
+				Enum: []string{"CSAF, Inc."},
+			},
+		},
+	}
+
+	doc := GenerateJSON(t, NewTestGenerator(t, WithTemplate(tmpl)))
+	AssertJSONPath(t, doc, "/a~1b/1", "CSAF, Inc.")
+	AssertJSONPath(t, doc, "/a~1b", `["CSAF, Inc.","CSAF, Inc."]`)
+}
+
+func TestGenerateCSAF(t *testing.T) {
+	doc := GenerateJSON(t, NewTestGenerator(t))
+	AssertJSONPath(t, doc, "/document/csaf_version", "2.0")
+}